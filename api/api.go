@@ -3,7 +3,9 @@ package api
 //go:generate go run github.com/Khan/genqlient
 
 import (
+	"bytes"
 	"context"
+	"crypto/x509"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -11,11 +13,11 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/Khan/genqlient/graphql"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
-	"github.com/vektah/gqlparser/v2/gqlerror"
 	"golang.org/x/oauth2"
 )
 
@@ -30,7 +32,10 @@ func (s *loggingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 	resp, err := s.wrapped.RoundTrip(r)
 	// err is returned after dumping the response
 
-	respBytes, _ := httputil.DumpResponse(resp, true)
+	var respBytes []byte
+	if resp != nil {
+		respBytes, _ = httputil.DumpResponse(resp, true)
+	}
 	fmt.Printf("%s\n", respBytes)
 	fmt.Println("==============")
 
@@ -39,27 +44,19 @@ func (s *loggingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 	return resp, err
 }
 
-func injectLoggingTransport(c *http.Client) {
-	if c.Transport == nil {
-		c.Transport = http.DefaultTransport
-	}
-	c.Transport = &loggingTransport{c.Transport}
-}
-
 func newClient(apiURL url.URL, apiToken string) (graphql.Client, error) {
-	var httpClient *http.Client
-
 	src := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: apiToken, TokenType: "bearer"},
 	)
-	httpClient = oauth2.NewClient(context.Background(), src)
-
+	var transport http.RoundTripper = &oauth2.Transport{
+		Source: src,
+		Base:   &retryTransport{wrapped: http.DefaultTransport, options: transportOptions},
+	}
+	// the request is dumped before the token is added, so it is not logged
 	if logrus.GetLevel() == logrus.DebugLevel {
-		if httpClient == nil {
-			httpClient = http.DefaultClient
-		}
-		injectLoggingTransport(httpClient)
+		transport = &loggingTransport{transport}
 	}
+	httpClient := &http.Client{Transport: transport}
 
 	graphQLURL := &apiURL
 	if !strings.HasSuffix(graphQLURL.Path, "/graphql") {
@@ -68,7 +65,7 @@ func newClient(apiURL url.URL, apiToken string) (graphql.Client, error) {
 
 	logrus.WithField("graphql_url", graphQLURL.String()).Debug("init graphql client")
 	client := graphql.NewClient(graphQLURL.String(), httpClient)
-	return client, nil
+	return &timeoutClient{wrapped: client, timeout: transportOptions.Timeout}, nil
 }
 
 type DrivrAPI struct {
@@ -87,12 +84,19 @@ func NewDrivrAPI(apiURL *url.URL, apiToken string) (*DrivrAPI, error) {
 func (d *DrivrAPI) FetchCertificateAuthority(ctx context.Context, issuer string) ([]byte, error) {
 	resp, err := fetchCAByName(ctx, d.client, issuer)
 	if err != nil {
+		err = classifyError(ctx, err)
 		logrus.WithField("issuer", issuer).WithError(err).Error("Failed to query CA")
 		return nil, err
 	}
 
+	if len(resp.Issuers.Items) == 0 {
+		err := &NotFoundError{Kind: "issuer", Key: issuer}
+		logrus.WithError(err).Error("Failed to fetch CA certificate")
+		return nil, err
+	}
+
 	if resp.Issuers.Items[0].Ca == "" {
-		err := errors.New("No CA found for issuer")
+		err := &NotFoundError{Kind: "CA of issuer", Key: issuer}
 		logrus.WithError(err).WithField("issuer", issuer).Error("Failed to fetch CA certificate")
 		return nil, err
 	}
@@ -108,9 +112,35 @@ func (d *DrivrAPI) FetchCertificateAuthority(ctx context.Context, issuer string)
 	return decodedCa.Bytes, nil
 }
 
+// FetchCertificateIssuerCA returns the DER encoded CA and the name of the issuer which signed the certificate.
+func (d *DrivrAPI) FetchCertificateIssuerCA(ctx context.Context, uuid *uuid.UUID) ([]byte, string, error) {
+	resp, err := fetchCertificateIssuerCA(ctx, d.client, *uuid)
+	if err != nil {
+		err = classifyError(ctx, err)
+		logrus.WithField("certificate_uuid", uuid).WithError(err).Error("Failed to query certificate issuer")
+		return nil, "", err
+	}
+
+	issuer := resp.Certificate.Issuer.Name
+	if resp.Certificate.Issuer.Ca == "" {
+		err := &NotFoundError{Kind: "CA of issuer", Key: issuer}
+		logrus.WithError(err).WithField("issuer", issuer).Error("Failed to fetch CA certificate")
+		return nil, issuer, err
+	}
+
+	decodedCa, _ := pem.Decode([]byte(resp.Certificate.Issuer.Ca))
+	if decodedCa == nil {
+		logrus.WithField("issuer", issuer).Error("Failed to decode CA certificate")
+		return nil, issuer, errors.New("Failed to decode CA certificate")
+	}
+
+	return decodedCa.Bytes, issuer, nil
+}
+
 func (d *DrivrAPI) FetchCertificate(ctx context.Context, uuid *uuid.UUID) ([]byte, string, error) {
 	resp, err := fetchCertificate(ctx, d.client, *uuid)
 	if err != nil {
+		err = classifyError(ctx, err)
 		logrus.WithField("uuid", uuid).WithError(err).Error("Failed to query certificate")
 		return nil, "", err
 	}
@@ -119,7 +149,7 @@ func (d *DrivrAPI) FetchCertificate(ctx context.Context, uuid *uuid.UUID) ([]byt
 
 	if resp.Certificate.Certificate == "" {
 		logrus.WithField("certificate_uuid", uuid).Debug("Certificate not yet signed")
-		return nil, name, errors.New("Certificate not yet signed")
+		return nil, name, ErrNotYetSigned
 	}
 
 	certificate := resp.Certificate.Certificate
@@ -133,16 +163,125 @@ func (d *DrivrAPI) FetchCertificate(ctx context.Context, uuid *uuid.UUID) ([]byt
 	return decodedCert.Bytes, name, nil
 }
 
+// CertificateDetails describes how a certificate was requested from DRIVR.
+type CertificateDetails struct {
+	UUID       uuid.UUID
+	Name       string
+	EntityUUID uuid.UUID
+	EntityType CertificateEntityType
+	IssuerUUID uuid.UUID
+	Issuer     string
+	Duration   string
+	Usages     []CertificateUsage
+	ExpiresAt  time.Time
+}
+
+// ServerUse reports whether the certificate may be used for server authentication.
+func (c *CertificateDetails) ServerUse() bool {
+	for _, usage := range c.Usages {
+		if usage == CertificateUsageServerAuth {
+			return true
+		}
+	}
+	return false
+}
+
+func newCertificateDetails(details *certificateDetails) *CertificateDetails {
+	return &CertificateDetails{
+		UUID:       details.Uuid,
+		Name:       details.Name,
+		EntityUUID: details.EntityUuid,
+		EntityType: details.EntityType,
+		IssuerUUID: details.Issuer.Uuid,
+		Issuer:     details.Issuer.Name,
+		Duration:   details.Duration,
+		Usages:     details.Usages,
+		ExpiresAt:  details.ExpiresAt,
+	}
+}
+
+// FetchCertificateDetails returns the request details of the certificate with the given UUID.
+func (d *DrivrAPI) FetchCertificateDetails(ctx context.Context, uuid *uuid.UUID) (*CertificateDetails, error) {
+	resp, err := fetchCertificateDetails(ctx, d.client, *uuid)
+	if err != nil {
+		err = classifyError(ctx, err)
+		logrus.WithField("certificate_uuid", uuid).WithError(err).Error("Failed to query certificate")
+		return nil, err
+	}
+	return newCertificateDetails(&resp.Certificate.certificateDetails), nil
+}
+
+// findCertificateWindow is the tolerance when matching the expiry of a certificate with the one stored in DRIVR.
+const findCertificateWindow = time.Minute
+
+// FindCertificate returns the request details of the DER encoded certificate. DRIVR cannot be queried for
+// the certificate itself, so the certificates expiring at the same time are compared with it.
+func (d *DrivrAPI) FindCertificate(ctx context.Context, certificate []byte) (*CertificateDetails, error) {
+	parsed, err := x509.ParseCertificate(certificate)
+	if err != nil {
+		return nil, err
+	}
+	from := parsed.NotAfter.Add(-findCertificateWindow)
+	to := parsed.NotAfter.Add(findCertificateWindow)
+
+	for offset := 0; ; offset += selectPageSize {
+		resp, err := fetchCertificatesByExpiry(ctx, d.client, from, to, offset, selectPageSize)
+		if err != nil {
+			err = classifyError(ctx, err)
+			logrus.WithError(err).Error("Failed to query certificates")
+			return nil, err
+		}
+		for _, item := range resp.Certificates.Items {
+			if block, _ := pem.Decode([]byte(item.Certificate)); block != nil && bytes.Equal(block.Bytes, certificate) {
+				return newCertificateDetails(&item.certificateDetails), nil
+			}
+		}
+		if len(resp.Certificates.Items) < selectPageSize {
+			break
+		}
+	}
+
+	logrus.Error("Certificate not found")
+	return nil, &NotFoundError{Kind: "certificate"}
+}
+
+// RequestedCertificate is a certificate requested from DRIVR together with its certificate signing request.
+type RequestedCertificate struct {
+	CertificateDetails
+	// CSR is the PEM encoded certificate signing request.
+	CSR string
+}
+
+// FindCertificatesByName returns the certificates with the given name which were requested for the entity.
+func (d *DrivrAPI) FindCertificatesByName(ctx context.Context, name string, entityUUID uuid.UUID) ([]RequestedCertificate, error) {
+	resp, err := fetchCertificatesByNameAndEntity(ctx, d.client, name, entityUUID)
+	if err != nil {
+		err = classifyError(ctx, err)
+		logrus.WithField("name", name).WithError(err).Error("Failed to query certificates")
+		return nil, err
+	}
+
+	certificates := make([]RequestedCertificate, 0, len(resp.Certificates.Items))
+	for _, item := range resp.Certificates.Items {
+		certificates = append(certificates, RequestedCertificate{
+			CertificateDetails: *newCertificateDetails(&item.certificateDetails),
+			CSR:                item.Csr,
+		})
+	}
+	return certificates, nil
+}
+
 func (d *DrivrAPI) FetchIssuerUUID(ctx context.Context, name string) (*uuid.UUID, error) {
 	resp, err := fetchIssuerUUIDByName(ctx, d.client, name)
 	if err != nil {
+		err = classifyError(ctx, err)
 		logrus.WithField("issuer", name).WithError(err).Error("Failed to query issuer")
 		return nil, err
 	}
 
 	if len(resp.Issuers.Items) != 1 {
 		logrus.WithField("issuer", name).Error("Issuer not found")
-		return nil, errors.New("Issuer not found")
+		return nil, &NotFoundError{Kind: "issuer", Key: name}
 	}
 
 	uuid := resp.Issuers.Items[0].Uuid
@@ -152,6 +291,7 @@ func (d *DrivrAPI) FetchIssuerUUID(ctx context.Context, name string) (*uuid.UUID
 func (d *DrivrAPI) FetchDomainUUID(ctx context.Context) (*uuid.UUID, error) {
 	resp, err := fetchDomainUUID(ctx, d.client)
 	if err != nil {
+		err = classifyError(ctx, err)
 		logrus.WithError(err).Error("Failed to query domain")
 		return nil, err
 	}
@@ -163,13 +303,14 @@ func (d *DrivrAPI) FetchDomainUUID(ctx context.Context) (*uuid.UUID, error) {
 func (d *DrivrAPI) FetchSystemUUID(ctx context.Context, code string) (*uuid.UUID, error) {
 	resp, err := fetchSystemUUIDByCode(ctx, d.client, code)
 	if err != nil {
+		err = classifyError(ctx, err)
 		logrus.WithError(err).Error("Failed to query system")
 		return nil, err
 	}
 
 	if len(resp.Systems.Items) == 0 {
 		logrus.WithField("system_code", code).Error("System not found")
-		return nil, errors.New("System not found")
+		return nil, &NotFoundError{Kind: "system", Key: code}
 	}
 
 	uuid := resp.Systems.Items[0].Uuid
@@ -179,19 +320,80 @@ func (d *DrivrAPI) FetchSystemUUID(ctx context.Context, code string) (*uuid.UUID
 func (d *DrivrAPI) FetchComponentUUID(ctx context.Context, code string) (*uuid.UUID, error) {
 	resp, err := fetchComponentUUIDByCode(ctx, d.client, code)
 	if err != nil {
+		err = classifyError(ctx, err)
 		logrus.WithError(err).Error("Failed to query component")
 		return nil, err
 	}
 
 	if len(resp.Components.Items) == 0 {
 		logrus.WithField("component_code", code).Error("Component not found")
-		return nil, errors.New("Component not found")
+		return nil, &NotFoundError{Kind: "component", Key: code}
 	}
 
 	uuid := resp.Components.Items[0].Uuid
 	return &uuid, nil
 }
 
+// EntityFilter is a where filter for systems or components, e.g. {"code": {"_like": "GW-%"}}.
+type EntityFilter map[string]any
+
+// Entity is a system or component matched by a filter.
+type Entity struct {
+	UUID uuid.UUID
+	Code string
+	Name string
+}
+
+const selectPageSize = 100
+
+// SelectSystems returns all systems matching the filter.
+func (d *DrivrAPI) SelectSystems(ctx context.Context, where EntityFilter) ([]Entity, error) {
+	var entities []Entity
+	for offset := 0; ; offset += selectPageSize {
+		resp, err := selectSystems(ctx, d.client, where, offset, selectPageSize)
+		if err != nil {
+			err = classifyError(ctx, err)
+			logrus.WithError(err).Error("Failed to query systems")
+			return nil, err
+		}
+		for _, item := range resp.Systems.Items {
+			entities = append(entities, Entity{UUID: item.Uuid, Code: item.Code, Name: item.Name})
+		}
+		if len(resp.Systems.Items) < selectPageSize || len(entities) >= resp.Systems.TotalItems {
+			return entities, nil
+		}
+	}
+}
+
+// SelectComponents returns all components matching the filter.
+func (d *DrivrAPI) SelectComponents(ctx context.Context, where EntityFilter) ([]Entity, error) {
+	var entities []Entity
+	for offset := 0; ; offset += selectPageSize {
+		resp, err := selectComponents(ctx, d.client, where, offset, selectPageSize)
+		if err != nil {
+			err = classifyError(ctx, err)
+			logrus.WithError(err).Error("Failed to query components")
+			return nil, err
+		}
+		for _, item := range resp.Components.Items {
+			entities = append(entities, Entity{UUID: item.Uuid, Code: item.Code, Name: item.Name})
+		}
+		if len(resp.Components.Items) < selectPageSize || len(entities) >= resp.Components.TotalItems {
+			return entities, nil
+		}
+	}
+}
+
+// DeleteCertificate deletes the certificate with the given UUID.
+func (d *DrivrAPI) DeleteCertificate(ctx context.Context, uuid *uuid.UUID) error {
+	if _, err := deleteCertificate(ctx, d.client, *uuid); err != nil {
+		err = classifyError(ctx, err)
+		logrus.WithField("certificate_uuid", uuid).WithError(err).Error("Failed to delete certificate")
+		return err
+	}
+	return nil
+}
+
 type CreateCertificateInput struct {
 	IssuerUUID   uuid.UUID
 	EntityUUID   uuid.UUID
@@ -221,17 +423,9 @@ func (d *DrivrAPI) CreateCertificate(ctx context.Context, input CreateCertificat
 
 	resp, err := createCertificate(ctx, d.client, input.IssuerUUID, input.Name, input.Duration, input.CSR, input.EntityUUID, usages)
 	if err != nil {
-		extensions := err.(gqlerror.List)[0].Extensions
-		sanitizedErrorMsg := ""
-		if errors, ok := extensions["errors"]; ok {
-			for code, msg := range errors.(map[string]interface{}) {
-				sanitizedErrorMsg = fmt.Sprintf("%s %v [%s].", sanitizedErrorMsg, msg, code)
-			}
-		}
-		newErr := fmt.Errorf("failed to create certificate: %v", sanitizedErrorMsg)
-		return nil, newErr
+		return nil, fmt.Errorf("failed to create certificate: %w", classifyError(ctx, err))
 	}
 
 	uuid := resp.CreateCertificate.Uuid
-	return &uuid, err
+	return &uuid, nil
 }
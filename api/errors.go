@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Khan/genqlient/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// Sentinel errors of the DrivrAPI methods. The returned errors wrap them, so they can be tested with errors.Is.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrValidation   = errors.New("validation failed")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrTransport    = errors.New("request to DRIVR failed")
+	ErrNotYetSigned = errors.New("certificate not yet signed")
+)
+
+// NotFoundError reports that a DRIVR object does not exist.
+type NotFoundError struct {
+	// Kind is the type of the object, e.g. system or issuer.
+	Kind string
+	// Key identifies the object, e.g. the code or name.
+	Key string
+}
+
+func (e *NotFoundError) Error() string {
+	if e.Key == "" {
+		return e.Kind + " not found"
+	}
+	return fmt.Sprintf("%s %s not found", e.Kind, e.Key)
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// FieldError is a single error reported by DRIVR for an invalid input.
+type FieldError struct {
+	// Code is the DRIVR error code.
+	Code    string
+	Message string
+}
+
+// ValidationError reports that DRIVR rejected the input of a mutation.
+type ValidationError struct {
+	Message string
+	Fields  []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msg := e.Message
+	if len(e.Fields) > 0 {
+		msg += ":"
+	}
+	for _, field := range e.Fields {
+		msg = fmt.Sprintf("%s %s [%s].", msg, field.Message, field.Code)
+	}
+	return msg
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// TransportError reports that DRIVR could not be reached or did not answer with a GraphQL response.
+type TransportError struct {
+	// StatusCode is the HTTP status code, or 0 if no response was received.
+	StatusCode int
+	Err        error
+}
+
+func (e *TransportError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%v: HTTP %d: %v", ErrTransport, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("%v: %v", ErrTransport, e.Err)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+func (e *TransportError) Is(target error) bool {
+	return target == ErrTransport
+}
+
+// errorMessage joins the messages of the GraphQL errors.
+func errorMessage(list gqlerror.List) string {
+	messages := make([]string, 0, len(list))
+	for _, err := range list {
+		messages = append(messages, err.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// classifyError converts errors of the GraphQL client into the errors of this package.
+// Errors which cannot be classified are returned unchanged, context errors only if the context
+// of the caller is done. Otherwise a single request timed out, which is a transport error.
+func classifyError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		if ctx.Err() != nil {
+			return err
+		}
+		return &TransportError{Err: err}
+	}
+
+	var httpErr *graphql.HTTPError
+	if errors.As(err, &httpErr) {
+		message := errorMessage(httpErr.Response.Errors)
+		switch httpErr.StatusCode {
+		case http.StatusUnauthorized:
+			return fmt.Errorf("%w: %s", ErrUnauthorized, message)
+		case http.StatusForbidden:
+			return fmt.Errorf("%w: %s", ErrForbidden, message)
+		}
+		return &TransportError{StatusCode: httpErr.StatusCode, Err: errors.New(message)}
+	}
+
+	var list gqlerror.List
+	if !errors.As(err, &list) {
+		return &TransportError{Err: err}
+	}
+	if len(list) == 0 {
+		return err
+	}
+
+	first := list[0]
+	code, _ := first.Extensions["code"].(string)
+	switch strings.ToUpper(code) {
+	case "UNAUTHENTICATED", "UNAUTHORIZED":
+		return fmt.Errorf("%w: %s", ErrUnauthorized, first.Message)
+	case "FORBIDDEN":
+		return fmt.Errorf("%w: %s", ErrForbidden, first.Message)
+	case "NOT_FOUND":
+		return fmt.Errorf("%w: %s", ErrNotFound, first.Message)
+	}
+
+	if fieldErrors, ok := first.Extensions["errors"].(map[string]any); ok {
+		validationErr := &ValidationError{Message: first.Message}
+		for code, msg := range fieldErrors {
+			validationErr.Fields = append(validationErr.Fields, FieldError{Code: code, Message: fmt.Sprint(msg)})
+		}
+		sort.Slice(validationErr.Fields, func(i, j int) bool {
+			return validationErr.Fields[i].Code < validationErr.Fields[j].Code
+		})
+		return validationErr
+	}
+	return err
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Khan/genqlient/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestClassifyError(t *testing.T) {
+	graphQLError := func(code string, extensions map[string]any) error {
+		if code != "" {
+			if extensions == nil {
+				extensions = map[string]any{}
+			}
+			extensions["code"] = code
+		}
+		return fmt.Errorf("input: %w", gqlerror.List{{Message: "request failed", Extensions: extensions}})
+	}
+	httpError := func(status int) error {
+		return &graphql.HTTPError{StatusCode: status, Response: graphql.Response{Errors: gqlerror.List{{Message: "denied"}}}}
+	}
+	dialErr := errors.New("dial tcp: connection refused")
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now())
+	defer cancelExpired()
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		err    error
+		is     []error
+		isNot  []error
+		status int
+	}{
+		{name: "unauthenticated code", err: graphQLError("UNAUTHENTICATED", nil), is: []error{ErrUnauthorized}},
+		{name: "unauthorized code", err: graphQLError("unauthorized", nil), is: []error{ErrUnauthorized}},
+		{name: "forbidden code", err: graphQLError("FORBIDDEN", nil), is: []error{ErrForbidden}},
+		{name: "not found code", err: graphQLError("NOT_FOUND", nil), is: []error{ErrNotFound}},
+		{
+			name:  "field errors",
+			err:   graphQLError("", map[string]any{"errors": map[string]any{"name": "is reserved"}}),
+			is:    []error{ErrValidation},
+			isNot: []error{ErrTransport},
+		},
+		{name: "unknown code", err: graphQLError("INTERNAL", nil), isNot: []error{ErrTransport, ErrValidation, ErrNotFound}},
+		{name: "HTTP 401", err: httpError(http.StatusUnauthorized), is: []error{ErrUnauthorized}, isNot: []error{ErrTransport}},
+		{name: "HTTP 403", err: httpError(http.StatusForbidden), is: []error{ErrForbidden}, isNot: []error{ErrTransport}},
+		{name: "HTTP 502", err: httpError(http.StatusBadGateway), is: []error{ErrTransport}, status: http.StatusBadGateway},
+		{name: "connection error", err: fmt.Errorf("Post: %w", dialErr), is: []error{ErrTransport, dialErr}},
+		{name: "canceled", ctx: canceled, err: fmt.Errorf("Post: %w", context.Canceled), is: []error{context.Canceled}, isNot: []error{ErrTransport}},
+		{name: "deadline exceeded", ctx: expired, err: fmt.Errorf("Post: %w", context.DeadlineExceeded), is: []error{context.DeadlineExceeded}, isNot: []error{ErrTransport}},
+		{name: "request timeout", err: fmt.Errorf("Post: %w", context.DeadlineExceeded), is: []error{ErrTransport, context.DeadlineExceeded}},
+		{name: "request canceled", err: fmt.Errorf("Post: %w", context.Canceled), is: []error{ErrTransport}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			err := classifyError(ctx, tt.err)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, target := range tt.is {
+				if !errors.Is(err, target) {
+					t.Errorf("%v is not %v", err, target)
+				}
+			}
+			for _, target := range tt.isNot {
+				if errors.Is(err, target) {
+					t.Errorf("%v must not be %v", err, target)
+				}
+			}
+			if tt.status != 0 {
+				var transportErr *TransportError
+				if !errors.As(err, &transportErr) || transportErr.StatusCode != tt.status {
+					t.Errorf("expected a transport error with status %d, got %v", tt.status, err)
+				}
+			}
+		})
+	}
+
+	if err := classifyError(context.Background(), nil); err != nil {
+		t.Errorf("classifyError(nil) = %v", err)
+	}
+}
+
+func TestClassifyErrorValidationFields(t *testing.T) {
+	err := classifyError(context.Background(), gqlerror.List{{
+		Message:    "Invalid input",
+		Extensions: map[string]any{"errors": map[string]any{"name": "is reserved", "duration": "must be ISO 8601"}},
+	}})
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	want := []FieldError{{Code: "duration", Message: "must be ISO 8601"}, {Code: "name", Message: "is reserved"}}
+	if len(validationErr.Fields) != len(want) {
+		t.Fatalf("got fields %v, want %v", validationErr.Fields, want)
+	}
+	for i := range want {
+		if validationErr.Fields[i] != want[i] {
+			t.Errorf("got field %v, want %v", validationErr.Fields[i], want[i])
+		}
+	}
+	if got := err.Error(); got != "Invalid input: must be ISO 8601 [duration]. is reserved [name]." {
+		t.Errorf("unexpected message %q", got)
+	}
+}
+
+func TestNotFoundError(t *testing.T) {
+	err := error(&NotFoundError{Kind: "CA of issuer", Key: "default"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Error("NotFoundError is not ErrNotFound")
+	}
+	if got := err.Error(); got != "CA of issuer default not found" {
+		t.Errorf("unexpected message %q", got)
+	}
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Khan/genqlient/graphql"
+	"github.com/sirupsen/logrus"
+)
+
+// TransportOptions controls timeouts and retries of the requests sent to DRIVR.
+type TransportOptions struct {
+	// Timeout limits a GraphQL operation including all retries. Zero disables the limit.
+	Timeout time.Duration
+	// RequestTimeout limits a single HTTP request. Zero disables the limit.
+	RequestTimeout time.Duration
+	// MaxRetries is the number of times a failed request is retried.
+	MaxRetries int
+	// RetryMin and RetryMax bound the exponential backoff between retries.
+	RetryMin time.Duration
+	RetryMax time.Duration
+}
+
+// DefaultTransportOptions are used unless SetTransportOptions is called.
+var DefaultTransportOptions = TransportOptions{
+	Timeout:        5 * time.Minute,
+	RequestTimeout: 30 * time.Second,
+	MaxRetries:     5,
+	RetryMin:       500 * time.Millisecond,
+	RetryMax:       30 * time.Second,
+}
+
+var transportOptions = DefaultTransportOptions
+
+// SetTransportOptions sets the options used by all clients created afterwards.
+func SetTransportOptions(opts TransportOptions) {
+	transportOptions = opts
+}
+
+// retryTransport retries failed requests with jittered exponential backoff. Mutations are only retried
+// if they have certainly not been processed, i.e. the connection could not be established or the
+// request was rejected because of rate limiting.
+type retryTransport struct {
+	wrapped http.RoundTripper
+	options TransportOptions
+}
+
+func (t *retryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	mutation := isMutation(body)
+
+	for attempt := 0; ; attempt++ {
+		resp, err := t.attempt(r, body)
+
+		retryable, wait := t.shouldRetry(resp, err, mutation)
+		if !retryable || attempt >= t.options.MaxRetries || r.Context().Err() != nil {
+			return resp, err
+		}
+		if backoff := t.backoff(attempt); wait < backoff {
+			wait = backoff
+		}
+
+		log := logrus.WithField("attempt", attempt+1).WithField("retry_in", wait)
+		if err != nil {
+			log = log.WithError(err)
+		} else {
+			log = log.WithField("status", resp.StatusCode)
+			resp.Body.Close()
+		}
+		log.Warn("Request to DRIVR failed, retrying")
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-r.Context().Done():
+			timer.Stop()
+			return nil, r.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends the request once. The request timeout covers reading the response body.
+func (t *retryTransport) attempt(r *http.Request, body []byte) (*http.Response, error) {
+	ctx, cancel := r.Context(), context.CancelFunc(func() {})
+	if t.options.RequestTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t.options.RequestTimeout)
+	}
+
+	req := r.Clone(ctx)
+	if body != nil {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	resp, err := t.wrapped.RoundTrip(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// shouldRetry decides whether a failed attempt is retried and returns the delay requested by DRIVR.
+func (t *retryTransport) shouldRetry(resp *http.Response, err error, mutation bool) (bool, time.Duration) {
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return true, 0
+		}
+		// the request may have been processed if the connection broke afterwards
+		return !mutation, 0
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true, retryAfter(resp.Header.Get("Retry-After"))
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return !mutation, retryAfter(resp.Header.Get("Retry-After"))
+	}
+	return false, 0
+}
+
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	backoff := t.options.RetryMin << attempt
+	if backoff <= 0 || backoff > t.options.RetryMax {
+		backoff = t.options.RetryMax
+	}
+	jitter := time.Duration(rand.Int64N(int64(backoff)/5 + 1))
+	return backoff - backoff/10 + jitter
+}
+
+// retryAfter parses a Retry-After header given in seconds or as HTTP date.
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
+
+// isMutation reports whether the GraphQL request body contains a mutation.
+func isMutation(body []byte) bool {
+	var request struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		// treat unknown requests like mutations, so they are not retried blindly
+		return true
+	}
+	return strings.HasPrefix(strings.TrimSpace(request.Query), "mutation")
+}
+
+// cancelBody releases the context of an attempt once the response body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// timeoutClient limits the duration of GraphQL operations including all retries.
+type timeoutClient struct {
+	wrapped graphql.Client
+	timeout time.Duration
+}
+
+func (c *timeoutClient) MakeRequest(ctx context.Context, req *graphql.Request, resp *graphql.Response) error {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	return c.wrapped.MakeRequest(ctx, req, resp)
+}
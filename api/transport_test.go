@@ -0,0 +1,258 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	testQuery    = `{"query":"query fetchCertificate($uuid: UUID!) { certificate(uuid: $uuid) { uuid } }"}`
+	testMutation = `{"query":"mutation createCertificate($name: String!) { createCertificate(name: $name) { uuid } }"}`
+)
+
+// scriptedTransport answers the attempts with the given results in order and records the request bodies.
+type scriptedTransport struct {
+	results []scriptedResult
+	bodies  []string
+}
+
+type scriptedResult struct {
+	status int
+	header http.Header
+	err    error
+}
+
+func (t *scriptedTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	t.bodies = append(t.bodies, string(body))
+
+	result := t.results[min(len(t.bodies), len(t.results))-1]
+	if result.err != nil {
+		return nil, result.err
+	}
+	header := result.header
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		StatusCode: result.status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader("{}")),
+		Request:    r,
+	}, nil
+}
+
+func TestRetryTransport(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	resetErr := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+	ok := scriptedResult{status: http.StatusOK}
+
+	tests := []struct {
+		name         string
+		body         string
+		results      []scriptedResult
+		wantAttempts int
+		wantStatus   int
+		wantErr      bool
+	}{
+		{name: "query succeeds", body: testQuery, results: []scriptedResult{ok}, wantAttempts: 1, wantStatus: http.StatusOK},
+		{name: "query retried after dial error", body: testQuery, results: []scriptedResult{{err: dialErr}, ok}, wantAttempts: 2, wantStatus: http.StatusOK},
+		{name: "query retried after broken connection", body: testQuery, results: []scriptedResult{{err: resetErr}, ok}, wantAttempts: 2, wantStatus: http.StatusOK},
+		{name: "query retried after 503", body: testQuery, results: []scriptedResult{{status: http.StatusServiceUnavailable}, ok}, wantAttempts: 2, wantStatus: http.StatusOK},
+		{name: "query retried after 502 and 504", body: testQuery, results: []scriptedResult{{status: http.StatusBadGateway}, {status: http.StatusGatewayTimeout}, ok}, wantAttempts: 3, wantStatus: http.StatusOK},
+		{name: "query retried after 429", body: testQuery, results: []scriptedResult{{status: http.StatusTooManyRequests}, ok}, wantAttempts: 2, wantStatus: http.StatusOK},
+		{name: "query not retried after 500", body: testQuery, results: []scriptedResult{{status: http.StatusInternalServerError}, ok}, wantAttempts: 1, wantStatus: http.StatusInternalServerError},
+		{name: "query not retried after 401", body: testQuery, results: []scriptedResult{{status: http.StatusUnauthorized}, ok}, wantAttempts: 1, wantStatus: http.StatusUnauthorized},
+		{name: "query gives up after max retries", body: testQuery, results: []scriptedResult{{status: http.StatusServiceUnavailable}}, wantAttempts: 4, wantStatus: http.StatusServiceUnavailable},
+		{name: "mutation retried after dial error", body: testMutation, results: []scriptedResult{{err: dialErr}, ok}, wantAttempts: 2, wantStatus: http.StatusOK},
+		{name: "mutation retried after 429", body: testMutation, results: []scriptedResult{{status: http.StatusTooManyRequests}, ok}, wantAttempts: 2, wantStatus: http.StatusOK},
+		{name: "mutation not retried after broken connection", body: testMutation, results: []scriptedResult{{err: resetErr}, ok}, wantAttempts: 1, wantErr: true},
+		{name: "mutation not retried after 503", body: testMutation, results: []scriptedResult{{status: http.StatusServiceUnavailable}, ok}, wantAttempts: 1, wantStatus: http.StatusServiceUnavailable},
+		{name: "mutation not retried after 502", body: testMutation, results: []scriptedResult{{status: http.StatusBadGateway}, ok}, wantAttempts: 1, wantStatus: http.StatusBadGateway},
+		{name: "unknown body treated as mutation", body: "not json", results: []scriptedResult{{status: http.StatusServiceUnavailable}, ok}, wantAttempts: 1, wantStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapped := &scriptedTransport{results: tt.results}
+			transport := &retryTransport{wrapped: wrapped, options: TransportOptions{
+				MaxRetries: 3,
+				RetryMin:   time.Millisecond,
+				RetryMax:   time.Millisecond,
+			}}
+
+			req, err := http.NewRequest(http.MethodPost, "http://drivr.invalid/graphql", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := transport.RoundTrip(req)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != tt.wantStatus {
+					t.Errorf("got status %d, want %d", resp.StatusCode, tt.wantStatus)
+				}
+			}
+
+			if len(wrapped.bodies) != tt.wantAttempts {
+				t.Errorf("got %d attempts, want %d", len(wrapped.bodies), tt.wantAttempts)
+			}
+			for i, body := range wrapped.bodies {
+				if body != tt.body {
+					t.Errorf("attempt %d sent body %q, want %q", i+1, body, tt.body)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryTransportRetryAfter(t *testing.T) {
+	wrapped := &scriptedTransport{results: []scriptedResult{
+		{status: http.StatusTooManyRequests, header: http.Header{"Retry-After": []string{"1"}}},
+		{status: http.StatusOK},
+	}}
+	transport := &retryTransport{wrapped: wrapped, options: TransportOptions{
+		MaxRetries: 1,
+		RetryMin:   time.Millisecond,
+		RetryMax:   time.Millisecond,
+	}}
+
+	req, err := http.NewRequest(http.MethodPost, "http://drivr.invalid/graphql", strings.NewReader(testMutation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, before the Retry-After delay", elapsed)
+	}
+}
+
+func TestRetryTransportCanceled(t *testing.T) {
+	wrapped := &scriptedTransport{results: []scriptedResult{{status: http.StatusServiceUnavailable}}}
+	transport := &retryTransport{wrapped: wrapped, options: TransportOptions{
+		MaxRetries: 5,
+		RetryMin:   time.Hour,
+		RetryMax:   time.Hour,
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://drivr.invalid/graphql", strings.NewReader(testQuery))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := transport.RoundTrip(req); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+	if len(wrapped.bodies) != 1 {
+		t.Errorf("got %d attempts, want 1", len(wrapped.bodies))
+	}
+}
+
+func TestIsMutation(t *testing.T) {
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{body: testQuery, want: false},
+		{body: `{"query":"  \n query { issuers { items { name } } }"}`, want: false},
+		{body: testMutation, want: true},
+		{body: `{"query":"\nmutation deleteCertificate { deleteCertificate(uuid: \"x\") }"}`, want: true},
+		{body: "", want: true},
+		{body: "not json", want: true},
+	}
+
+	for _, tt := range tests {
+		if got := isMutation([]byte(tt.body)); got != tt.want {
+			t.Errorf("isMutation(%q) = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	if got := retryAfter("3"); got != 3*time.Second {
+		t.Errorf("retryAfter(3) = %v", got)
+	}
+	for _, value := range []string{"", "0", "-1", "soon"} {
+		if got := retryAfter(value); got != 0 {
+			t.Errorf("retryAfter(%q) = %v, want 0", value, got)
+		}
+	}
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if got := retryAfter(date); got <= 55*time.Second || got > time.Minute {
+		t.Errorf("retryAfter(%q) = %v", date, got)
+	}
+	past := time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)
+	if got := retryAfter(past); got != 0 {
+		t.Errorf("retryAfter(%q) = %v, want 0", past, got)
+	}
+}
+
+func TestRequestTimeoutIsTransportError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	previous := transportOptions
+	defer SetTransportOptions(previous)
+	SetTransportOptions(TransportOptions{
+		RequestTimeout: 200 * time.Millisecond,
+		MaxRetries:     1,
+		RetryMin:       time.Millisecond,
+		RetryMax:       time.Millisecond,
+	})
+
+	apiURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drivrAPI, err := NewDrivrAPI(apiURL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificateUUID := uuid.New()
+	_, _, err = drivrAPI.FetchCertificate(context.Background(), &certificateUUID)
+	if !errors.Is(err, ErrTransport) {
+		t.Errorf("FetchCertificate returned %v, want a transport error", err)
+	}
+	_, err = drivrAPI.CreateCertificate(context.Background(), CreateCertificateInput{Name: "gw", Duration: "P1D"})
+	if !errors.Is(err, ErrTransport) {
+		t.Errorf("CreateCertificate returned %v, want a transport error", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, _, err = drivrAPI.FetchCertificate(ctx, &certificateUUID)
+	if !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrTransport) {
+		t.Errorf("FetchCertificate with expired context returned %v, want the context error", err)
+	}
+}
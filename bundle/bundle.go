@@ -0,0 +1,121 @@
+// Package bundle implements the request and response files which are exchanged between
+// an offline provisioning machine and an online machine with access to DRIVR,
+// as well as the metadata files stored next to issued certificates.
+package bundle
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/xcnt/drivr-certificate-client/cert"
+)
+
+const Version = 1
+
+// Request holds everything needed to request a certificate from DRIVR.
+type Request struct {
+	Name          string    `json:"name"`
+	SystemCode    string    `json:"systemCode,omitempty"`
+	ComponentCode string    `json:"componentCode,omitempty"`
+	Issuer        string    `json:"issuer"`
+	Duration      string    `json:"duration"`
+	Usages        []string  `json:"usages"`
+	CSR           string    `json:"csr"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// RequestBundle is a Request signed with the private key of its CSR.
+type RequestBundle struct {
+	Version   int     `json:"version"`
+	Request   Request `json:"request"`
+	Signature []byte  `json:"signature"`
+}
+
+// ResponseBundle holds the certificate issued for a RequestBundle.
+type ResponseBundle struct {
+	Version         int       `json:"version"`
+	Name            string    `json:"name"`
+	CertificateUUID uuid.UUID `json:"certificateUuid"`
+	Certificate     string    `json:"certificate"`
+}
+
+// NewRequestBundle signs the request with the private key which also signed its CSR.
+// The signature only protects the bundle against modification, it does not prove who created it:
+// anybody can create a key and a bundle signed with it.
+func NewRequestBundle(signer crypto.Signer, request Request) (*RequestBundle, error) {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := cert.SignData(signer, payload)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to sign request bundle")
+		return nil, err
+	}
+	return &RequestBundle{Version: Version, Request: request, Signature: signature}, nil
+}
+
+// Verify checks the version and signature of the bundle as well as the self-signature of the CSR
+// and returns the parsed CSR. A valid signature does not mean the bundle comes from a trusted source.
+func (b *RequestBundle) Verify() (*x509.CertificateRequest, error) {
+	if b.Version != Version {
+		return nil, fmt.Errorf("unsupported request bundle version %d", b.Version)
+	}
+	csr, err := cert.ParseCSR([]byte(b.Request.CSR))
+	if err != nil {
+		return nil, err
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid certificate request signature: %w", err)
+	}
+
+	payload, err := json.Marshal(b.Request)
+	if err != nil {
+		return nil, err
+	}
+	if err := cert.VerifySignature(csr.PublicKey, payload, b.Signature); err != nil {
+		return nil, fmt.Errorf("invalid request bundle signature: %w", err)
+	}
+	if b.Request.SystemCode == "" && b.Request.ComponentCode == "" {
+		return nil, errors.New("request bundle has neither a system nor a component code")
+	}
+	return csr, nil
+}
+
+// ParseCertificate returns the certificate of the response bundle.
+func (b *ResponseBundle) ParseCertificate() (*x509.Certificate, error) {
+	if b.Version != Version {
+		return nil, fmt.Errorf("unsupported response bundle version %d", b.Version)
+	}
+	return cert.ParseCertificate([]byte(b.Certificate))
+}
+
+// Write writes the bundle as JSON to a new file.
+func Write(bundle any, filename string, opts cert.WriteOptions) error {
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return err
+	}
+	return cert.WriteToFile(data, filename, false, opts)
+}
+
+// Load reads a JSON bundle from a file.
+func Load(filename string, bundle any) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		logrus.WithError(err).WithField("filename", filename).Error("Failed to read bundle")
+		return err
+	}
+	if err := json.Unmarshal(data, bundle); err != nil {
+		logrus.WithError(err).WithField("filename", filename).Error("Failed to parse bundle")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package bundle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xcnt/drivr-certificate-client/cert"
+)
+
+// Journal steps of a certificate request.
+const (
+	// JournalPrepared means the private key and CSR have been created but the certificate has not been requested yet.
+	JournalPrepared = "prepared"
+	// JournalRequested means the certificate has been requested from DRIVR but not written yet.
+	JournalRequested = "requested"
+)
+
+const journalExtension = ".json"
+
+// JournalEntry records the progress of a certificate request, so an interrupted run can be resumed.
+// The entry is removed once the certificate has been written.
+type JournalEntry struct {
+	Version int `json:"version"`
+	// ID is derived from the certificate file and names the journal file.
+	ID            string     `json:"id"`
+	Step          string     `json:"step"`
+	Name          string     `json:"name"`
+	SystemCode    string     `json:"systemCode,omitempty"`
+	ComponentCode string     `json:"componentCode,omitempty"`
+	EntityUUID    *uuid.UUID `json:"entityUuid,omitempty"`
+	Issuer        string     `json:"issuer"`
+	IssuerUUID    *uuid.UUID `json:"issuerUuid,omitempty"`
+	Duration      string     `json:"duration"`
+	ServerUse     bool       `json:"serverUse,omitempty"`
+	// CSR is the PEM encoded certificate signing request.
+	CSR             string     `json:"csr"`
+	PrivateKey      string     `json:"privateKey,omitempty"`
+	CertificateFile string     `json:"certificateFile"`
+	OutputFormat    string     `json:"outputFormat"`
+	WriteMetadata   bool       `json:"writeMetadata,omitempty"`
+	CertificateUUID *uuid.UUID `json:"certificateUuid,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+}
+
+// Journal stores the entries of unfinished certificate requests in a directory.
+type Journal struct {
+	Dir string
+}
+
+// JournalID returns the ID of the journal entry writing the certificate file.
+func JournalID(certificateFile string) string {
+	if abs, err := filepath.Abs(certificateFile); err == nil {
+		certificateFile = abs
+	}
+	sum := sha256.Sum256([]byte(certificateFile))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (j Journal) filename(id string) string {
+	return filepath.Join(j.Dir, id+journalExtension)
+}
+
+// Load returns the entry with the given ID or nil if there is none.
+func (j Journal) Load(id string) (*JournalEntry, error) {
+	filename := j.filename(id)
+	if _, err := os.Stat(filename); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	var entry JournalEntry
+	if err := Load(filename, &entry); err != nil {
+		return nil, err
+	}
+	if entry.Version != Version {
+		return nil, fmt.Errorf("unsupported journal version %d", entry.Version)
+	}
+	return &entry, nil
+}
+
+// List returns all entries ordered by creation time.
+func (j Journal) List() ([]*JournalEntry, error) {
+	files, err := os.ReadDir(j.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*JournalEntry
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), journalExtension) {
+			continue
+		}
+		entry, err := j.Load(strings.TrimSuffix(file.Name(), journalExtension))
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].CreatedAt.Before(entries[b].CreatedAt)
+	})
+	return entries, nil
+}
+
+// Save atomically replaces the journal file of the entry.
+func (j Journal) Save(entry *JournalEntry) error {
+	entry.Version = Version
+	entry.UpdatedAt = time.Now().UTC()
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = entry.UpdatedAt
+	}
+
+	if err := os.MkdirAll(j.Dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	return cert.ReplaceFile(data, j.filename(entry.ID), 0600)
+}
+
+// Remove deletes the entry with the given ID. Missing entries are ignored.
+func (j Journal) Remove(id string) error {
+	if err := os.Remove(j.filename(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
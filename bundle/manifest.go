@@ -0,0 +1,210 @@
+package bundle
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xcnt/drivr-certificate-client/cert"
+	"gopkg.in/yaml.v3"
+)
+
+// ManifestEntry describes a certificate to be provisioned.
+// The CSV columns are named like the YAML keys, lists are separated by spaces.
+type ManifestEntry struct {
+	Name          string `yaml:"name"`
+	SystemCode    string `yaml:"system_code"`
+	ComponentCode string `yaml:"component_code"`
+	// EntityUUID is used instead of looking up the system or component code if set.
+	EntityUUID *uuid.UUID `yaml:"entity_uuid"`
+	// Issuer and Duration default to the values given on the command line.
+	Issuer      string   `yaml:"issuer"`
+	Duration    string   `yaml:"duration"`
+	ServerName  string   `yaml:"server_name"`
+	CommonName  string   `yaml:"common_name"`
+	DNSNames    []string `yaml:"dns_names"`
+	IPAddresses []string `yaml:"ip_addresses"`
+}
+
+// Manifest lists the certificates to be provisioned.
+type Manifest struct {
+	Certificates []ManifestEntry `yaml:"certificates"`
+}
+
+// LoadManifest reads a manifest from a YAML or, if the file name ends with .csv, a CSV file.
+func LoadManifest(filename string) (*Manifest, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var manifest *Manifest
+	if strings.EqualFold(filepath.Ext(filename), ".csv") {
+		manifest, err = parseCSVManifest(file)
+	} else {
+		manifest = &Manifest{}
+		decoder := yaml.NewDecoder(file)
+		decoder.KnownFields(true)
+		err = decoder.Decode(manifest)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", filename, err)
+	}
+
+	if err := manifest.validate(); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", filename, err)
+	}
+	return manifest, nil
+}
+
+func parseCSVManifest(r io.Reader) (*Manifest, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var entry ManifestEntry
+		for i, column := range header {
+			value := strings.TrimSpace(record[i])
+			switch strings.TrimSpace(column) {
+			case "name":
+				entry.Name = value
+			case "system_code":
+				entry.SystemCode = value
+			case "component_code":
+				entry.ComponentCode = value
+			case "entity_uuid":
+				if value == "" {
+					continue
+				}
+				entityUUID, err := uuid.Parse(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid entity_uuid %s", value)
+				}
+				entry.EntityUUID = &entityUUID
+			case "issuer":
+				entry.Issuer = value
+			case "duration":
+				entry.Duration = value
+			case "server_name":
+				entry.ServerName = value
+			case "common_name":
+				entry.CommonName = value
+			case "dns_names":
+				entry.DNSNames = strings.Fields(value)
+			case "ip_addresses":
+				entry.IPAddresses = strings.Fields(value)
+			default:
+				return nil, fmt.Errorf("unknown column %s", column)
+			}
+		}
+		manifest.Certificates = append(manifest.Certificates, entry)
+	}
+	return manifest, nil
+}
+
+func (m *Manifest) validate() error {
+	if len(m.Certificates) == 0 {
+		return errors.New("no certificates listed")
+	}
+
+	names := make(map[string]bool, len(m.Certificates))
+	for i, entry := range m.Certificates {
+		switch {
+		case entry.Name == "":
+			return fmt.Errorf("certificate %d has no name", i+1)
+		case entry.Name != filepath.Base(entry.Name) || strings.HasPrefix(entry.Name, "."):
+			return fmt.Errorf("certificate name %s must not contain a path", entry.Name)
+		case names[entry.Name]:
+			return fmt.Errorf("certificate %s is listed twice", entry.Name)
+		case countSet(entry.SystemCode != "", entry.ComponentCode != "", entry.EntityUUID != nil) != 1:
+			return fmt.Errorf("certificate %s needs exactly one of system_code, component_code or entity_uuid", entry.Name)
+		}
+		names[entry.Name] = true
+	}
+	return nil
+}
+
+func countSet(values ...bool) int {
+	count := 0
+	for _, value := range values {
+		if value {
+			count++
+		}
+	}
+	return count
+}
+
+// Provisioning states of a manifest entry.
+const (
+	// ProvisionRequested means the certificate has been requested from DRIVR but not written yet.
+	ProvisionRequested = "requested"
+	// ProvisionIssued means the certificate has been written.
+	ProvisionIssued = "issued"
+	// ProvisionFailed means the certificate could not be requested.
+	ProvisionFailed = "failed"
+)
+
+// ProvisionStatus is the progress of a single manifest entry.
+type ProvisionStatus struct {
+	Status          string     `json:"status"`
+	CertificateUUID *uuid.UUID `json:"certificateUuid,omitempty"`
+	Error           string     `json:"error,omitempty"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+}
+
+// ProvisionState records the progress of a provisioning run, so an interrupted run can be resumed
+// without requesting certificates twice.
+type ProvisionState struct {
+	Version      int                         `json:"version"`
+	Certificates map[string]*ProvisionStatus `json:"certificates"`
+}
+
+// LoadProvisionState reads a state file. A missing file results in an empty state.
+func LoadProvisionState(filename string) (*ProvisionState, error) {
+	state := &ProvisionState{Version: Version, Certificates: map[string]*ProvisionStatus{}}
+	if _, err := os.Stat(filename); errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err := Load(filename, state); err != nil {
+		return nil, err
+	}
+	if state.Version != Version {
+		return nil, fmt.Errorf("unsupported state version %d", state.Version)
+	}
+	if state.Certificates == nil {
+		state.Certificates = map[string]*ProvisionStatus{}
+	}
+	return state, nil
+}
+
+// Save atomically replaces the state file.
+func (s *ProvisionState) Save(filename string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return cert.ReplaceFile(data, filename, 0644)
+}
@@ -0,0 +1,49 @@
+package bundle
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xcnt/drivr-certificate-client/cert"
+)
+
+// Metadata is stored next to an issued certificate and records how it was requested,
+// so it can be renewed without repeating the original flags.
+type Metadata struct {
+	Version         int       `json:"version"`
+	CertificateUUID uuid.UUID `json:"certificateUuid"`
+	Name            string    `json:"name"`
+	SystemCode      string    `json:"systemCode,omitempty"`
+	ComponentCode   string    `json:"componentCode,omitempty"`
+	// EntityUUID is used instead of the system or component code if set.
+	EntityUUID *uuid.UUID `json:"entityUuid,omitempty"`
+	Issuer     string     `json:"issuer"`
+	Duration   string     `json:"duration"`
+	Usages     []string   `json:"usages"`
+	PrivateKey string     `json:"privateKey,omitempty"`
+	IssuedAt   time.Time  `json:"issuedAt"`
+}
+
+// MetadataFilename returns the name of the metadata file belonging to a certificate file.
+func MetadataFilename(certificateFile string) string {
+	return certificateFile + ".meta.json"
+}
+
+// LoadMetadata reads the metadata file belonging to a certificate file.
+func LoadMetadata(certificateFile string) (*Metadata, error) {
+	var metadata Metadata
+	if err := Load(MetadataFilename(certificateFile), &metadata); err != nil {
+		return nil, err
+	}
+	if metadata.Version != Version {
+		return nil, fmt.Errorf("unsupported metadata version %d", metadata.Version)
+	}
+	return &metadata, nil
+}
+
+// WriteMetadata writes the metadata file belonging to a certificate file.
+func WriteMetadata(metadata *Metadata, certificateFile string, opts cert.WriteOptions) error {
+	metadata.Version = Version
+	return Write(metadata, MetadataFilename(certificateFile), opts)
+}
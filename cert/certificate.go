@@ -0,0 +1,95 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LoadCertificate reads a PEM or DER encoded certificate from a file.
+func LoadCertificate(filename string) (*x509.Certificate, error) {
+	certBytes, err := os.ReadFile(filename)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to read certificate from file")
+		return nil, err
+	}
+
+	certificate, err := ParseCertificate(certBytes)
+	if err != nil {
+		logrus.WithError(err).WithField("filename", filename).Error("Failed to parse certificate")
+		return nil, err
+	}
+
+	return certificate, nil
+}
+
+// LoadCertificateChain reads all certificates from a file. The first one is the leaf certificate,
+// the others are the chain certificates following it, like in fullchain or combined files.
+func LoadCertificateChain(filename string) ([]*x509.Certificate, error) {
+	certBytes, err := os.ReadFile(filename)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to read certificate from file")
+		return nil, err
+	}
+
+	certificates, err := ParseCertificates(certBytes)
+	if err != nil {
+		logrus.WithError(err).WithField("filename", filename).Error("Failed to parse certificate")
+		return nil, err
+	}
+
+	return certificates, nil
+}
+
+// IsSelfSigned reports whether the certificate is signed by its own key, which is the case for root CAs.
+func IsSelfSigned(certificate *x509.Certificate) bool {
+	return bytes.Equal(certificate.RawIssuer, certificate.RawSubject) && certificate.CheckSignatureFrom(certificate) == nil
+}
+
+// ParseCertificate parses a PEM or DER encoded certificate.
+func ParseCertificate(data []byte) (*x509.Certificate, error) {
+	der := data
+	if block, _ := pem.Decode(data); block != nil {
+		if PEMType(block.Type) != Certificate {
+			return nil, fmt.Errorf("unsupported PEM block type %s", block.Type)
+		}
+		der = block.Bytes
+	}
+
+	return x509.ParseCertificate(der)
+}
+
+// ParseCertificates parses all PEM encoded certificates in data, or a single DER encoded certificate.
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if PEMType(block.Type) != Certificate {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+	if len(certificates) > 0 {
+		return certificates, nil
+	}
+
+	certificate, err := x509.ParseCertificate(data)
+	if err != nil {
+		return nil, errors.New("no certificate found")
+	}
+	return []*x509.Certificate{certificate}, nil
+}
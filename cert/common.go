@@ -3,40 +3,40 @@ package cert
 import (
 	"bytes"
 	"encoding/pem"
-	"fmt"
-	"os"
-
-	"github.com/sirupsen/logrus"
 )
 
 type PEMType string
 
 const (
-	RSAPrivateKey      PEMType = "RSA PRIVATE KEY"
-	RSAPublicKey       PEMType = "RSA PUBLIC KEY"
-	CertificateRequest PEMType = "CERTIFICATE REQUEST"
-	Certificate        PEMType = "CERTIFICATE"
+	RSAPrivateKey       PEMType = "RSA PRIVATE KEY"
+	RSAPublicKey        PEMType = "RSA PUBLIC KEY"
+	ECPrivateKey        PEMType = "EC PRIVATE KEY"
+	PrivateKey          PEMType = "PRIVATE KEY"
+	EncryptedPrivateKey PEMType = "ENCRYPTED PRIVATE KEY"
+	PublicKey           PEMType = "PUBLIC KEY"
+	CertificateRequest  PEMType = "CERTIFICATE REQUEST"
+	Certificate         PEMType = "CERTIFICATE"
 )
 
-func WriteToPEMFile(keyType PEMType, keyBytes []byte, filename string) error {
-	var buffer bytes.Buffer
-	if err := pem.Encode(&buffer, &pem.Block{Type: string(keyType), Bytes: keyBytes}); err != nil {
-		return err
+// IsSecret reports whether PEM blocks of this type contain private key material.
+func (t PEMType) IsSecret() bool {
+	switch t {
+	case RSAPrivateKey, ECPrivateKey, PrivateKey, EncryptedPrivateKey:
+		return true
 	}
+	return false
+}
 
-	var _, err = os.Stat(filename)
-	if err == nil {
-		logrus.WithField("outfile", filename).Error("file already exists")
-		return fmt.Errorf("file %s already exists", filename)
-	}
+// EncodePEM returns the PEM encoding of a single block.
+func EncodePEM(blockType PEMType, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: string(blockType), Bytes: der})
+}
 
-	f, err := os.Create(filename)
-	if err != nil {
-		logrus.WithError(err).WithField("filename", filename).Error("Failed to create PEM file")
+func WriteToPEMFile(keyType PEMType, keyBytes []byte, filename string, opts WriteOptions) error {
+	var buffer bytes.Buffer
+	if err := pem.Encode(&buffer, &pem.Block{Type: string(keyType), Bytes: keyBytes}); err != nil {
 		return err
 	}
-	defer f.Close()
 
-	_, err = f.Write(buffer.Bytes())
-	return err
+	return WriteToFile(buffer.Bytes(), filename, keyType.IsSecret(), opts)
 }
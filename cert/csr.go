@@ -1,31 +1,111 @@
 package cert
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"slices"
 
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
 )
 
+// CSRData holds the subject and Subject Alternative Names of a certificate request.
 type CSRData struct {
-	ServerName string
+	// CommonName defaults to a random UUID if empty.
+	CommonName         string
+	Organization       []string
+	OrganizationalUnit []string
+	Country            []string
+	Locality           []string
+	SerialNumber       string
+
+	// ServerName is added as the first DNS name.
+	ServerName  string
+	DNSNames    []string
+	IPAddresses []net.IP
+	URIs        []*url.URL
+}
+
+// CSRDataFromCertificate returns the subject and Subject Alternative Names of an issued certificate,
+// so a replacement with the same identity can be requested.
+func CSRDataFromCertificate(certificate *x509.Certificate) *CSRData {
+	return &CSRData{
+		CommonName:         certificate.Subject.CommonName,
+		Organization:       certificate.Subject.Organization,
+		OrganizationalUnit: certificate.Subject.OrganizationalUnit,
+		Country:            certificate.Subject.Country,
+		Locality:           certificate.Subject.Locality,
+		SerialNumber:       certificate.Subject.SerialNumber,
+		DNSNames:           certificate.DNSNames,
+		IPAddresses:        certificate.IPAddresses,
+		URIs:               certificate.URIs,
+	}
+}
+
+// SignatureAlgorithm returns the CSR signature algorithm matching the given public key.
+func SignatureAlgorithm(pubKey crypto.PublicKey) (x509.SignatureAlgorithm, error) {
+	switch key := pubKey.(type) {
+	case *rsa.PublicKey:
+		return x509.SHA512WithRSA, nil
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return x509.ECDSAWithSHA256, nil
+		case elliptic.P384():
+			return x509.ECDSAWithSHA384, nil
+		case elliptic.P521():
+			return x509.ECDSAWithSHA512, nil
+		}
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported elliptic curve %s", key.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return x509.PureEd25519, nil
+	default:
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported public key type %T", pubKey)
+	}
 }
 
-func CreateCSR(privKey *rsa.PrivateKey, csrData *CSRData) ([]byte, error) {
+func CreateCSR(privKey crypto.Signer, csrData *CSRData) ([]byte, error) {
+	signatureAlgorithm, err := SignatureAlgorithm(privKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	if csrData == nil {
+		csrData = &CSRData{}
+	}
 	subject := pkix.Name{
-		CommonName: uuid.New().String(),
+		CommonName:         csrData.CommonName,
+		Organization:       csrData.Organization,
+		OrganizationalUnit: csrData.OrganizationalUnit,
+		Country:            csrData.Country,
+		Locality:           csrData.Locality,
+		SerialNumber:       csrData.SerialNumber,
+	}
+	if subject.CommonName == "" {
+		subject.CommonName = uuid.New().String()
 	}
 	dnsNames := []string{}
-	if csrData != nil && csrData.ServerName != "" {
+	if csrData.ServerName != "" {
 		dnsNames = append(dnsNames, csrData.ServerName)
 	}
+	dnsNames = append(dnsNames, csrData.DNSNames...)
 	var csrTemplate = x509.CertificateRequest{
 		Subject:            subject,
-		SignatureAlgorithm: x509.SHA512WithRSA,
+		SignatureAlgorithm: signatureAlgorithm,
 		DNSNames:           dnsNames,
+		IPAddresses:        csrData.IPAddresses,
+		URIs:               csrData.URIs,
 	}
 
 	csrCertificate, err := x509.CreateCertificateRequest(rand.Reader, &csrTemplate, privKey)
@@ -37,3 +117,60 @@ func CreateCSR(privKey *rsa.PrivateKey, csrData *CSRData) ([]byte, error) {
 	})
 	return csr, nil
 }
+
+// LoadCSR reads a PEM or DER encoded certificate request from a file.
+func LoadCSR(filename string) (*x509.CertificateRequest, error) {
+	csrBytes, err := os.ReadFile(filename)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to read certificate request from file")
+		return nil, err
+	}
+
+	csr, err := ParseCSR(csrBytes)
+	if err != nil {
+		logrus.WithError(err).WithField("filename", filename).Error("Failed to parse certificate request")
+		return nil, err
+	}
+
+	return csr, nil
+}
+
+// ParseCSR parses a PEM or DER encoded certificate request.
+func ParseCSR(data []byte) (*x509.CertificateRequest, error) {
+	der := data
+	if block, _ := pem.Decode(data); block != nil {
+		if PEMType(block.Type) != CertificateRequest && block.Type != "NEW CERTIFICATE REQUEST" {
+			return nil, fmt.Errorf("unsupported PEM block type %s", block.Type)
+		}
+		der = block.Bytes
+	}
+
+	return x509.ParseCertificateRequest(der)
+}
+
+// ValidateCSR checks the self-signature of an externally generated certificate request and
+// that its contents can be signed by DRIVR. If a server name is given it must be one of the DNS names.
+func ValidateCSR(csr *x509.CertificateRequest, serverName string) error {
+	if err := csr.CheckSignature(); err != nil {
+		return fmt.Errorf("invalid certificate request signature: %w", err)
+	}
+
+	if _, err := SignatureAlgorithm(csr.PublicKey); err != nil {
+		return err
+	}
+
+	if csr.Subject.CommonName == "" {
+		return errors.New("certificate request has no common name")
+	}
+
+	if serverName != "" && !slices.Contains(csr.DNSNames, serverName) {
+		return fmt.Errorf("certificate request does not contain the server name %s", serverName)
+	}
+
+	return nil
+}
+
+// EncodeCSR returns the PEM encoding of the certificate request.
+func EncodeCSR(csr *x509.CertificateRequest) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: string(CertificateRequest), Bytes: csr.Raw})
+}
@@ -0,0 +1,273 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Info describes a single certificate, certificate request or key found in a file.
+type Info struct {
+	Type               PEMType           `json:"type"`
+	Subject            string            `json:"subject,omitempty"`
+	Issuer             string            `json:"issuer,omitempty"`
+	SerialNumber       string            `json:"serialNumber,omitempty"`
+	NotBefore          *time.Time        `json:"notBefore,omitempty"`
+	NotAfter           *time.Time        `json:"notAfter,omitempty"`
+	IsCA               bool              `json:"isCA,omitempty"`
+	DNSNames           []string          `json:"dnsNames,omitempty"`
+	IPAddresses        []string          `json:"ipAddresses,omitempty"`
+	URIs               []string          `json:"uris,omitempty"`
+	EmailAddresses     []string          `json:"emailAddresses,omitempty"`
+	KeyUsage           []string          `json:"keyUsage,omitempty"`
+	ExtKeyUsage        []string          `json:"extKeyUsage,omitempty"`
+	SignatureAlgorithm string            `json:"signatureAlgorithm,omitempty"`
+	PublicKeyAlgorithm string            `json:"publicKeyAlgorithm"`
+	Fingerprints       map[string]string `json:"fingerprints"`
+	// KeyMatches is set if a private key was given to compare against.
+	KeyMatches *bool `json:"keyMatches,omitempty"`
+
+	publicKey crypto.PublicKey
+}
+
+// Inspect describes every certificate, certificate request and key in the PEM or DER encoded data.
+// The passphrase function is used for encrypted private keys and may be nil.
+func Inspect(data []byte, passphrase PassphraseFunc) ([]*Info, error) {
+	var infos []*Info
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		info, err := inspectPEMBlock(block, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	if len(infos) > 0 {
+		return infos, nil
+	}
+
+	info, err := inspectDER(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return []*Info{info}, nil
+}
+
+// MatchKey records in KeyMatches whether the public key of the info belongs to the private key.
+func (i *Info) MatchKey(privKey crypto.Signer) {
+	matches := PublicKeysEqual(privKey.Public(), i.publicKey)
+	i.KeyMatches = &matches
+}
+
+func inspectPEMBlock(block *pem.Block, passphrase PassphraseFunc) (*Info, error) {
+	switch PEMType(block.Type) {
+	case Certificate:
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return certificateInfo(certificate), nil
+	case CertificateRequest:
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return csrInfo(csr), nil
+	case RSAPrivateKey, ECPrivateKey, PrivateKey, EncryptedPrivateKey:
+		privKey, err := ParsePrivateKey(pem.EncodeToMemory(block), passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return publicKeyInfo(PEMType(block.Type), privKey.Public()), nil
+	case RSAPublicKey:
+		pubKey, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return publicKeyInfo(RSAPublicKey, pubKey), nil
+	case PublicKey:
+		pubKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return publicKeyInfo(PublicKey, pubKey), nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %s", block.Type)
+	}
+}
+
+func inspectDER(der []byte, passphrase PassphraseFunc) (*Info, error) {
+	if certificate, err := x509.ParseCertificate(der); err == nil {
+		return certificateInfo(certificate), nil
+	}
+	if csr, err := x509.ParseCertificateRequest(der); err == nil {
+		return csrInfo(csr), nil
+	}
+	if pubKey, err := x509.ParsePKIXPublicKey(der); err == nil {
+		return publicKeyInfo(PublicKey, pubKey), nil
+	}
+	if privKey, err := ParsePrivateKey(der, passphrase); err == nil {
+		return publicKeyInfo(PrivateKey, privKey.Public()), nil
+	}
+	return nil, errors.New("no certificate, certificate request or key found")
+}
+
+func certificateInfo(certificate *x509.Certificate) *Info {
+	notBefore := certificate.NotBefore
+	notAfter := certificate.NotAfter
+	info := &Info{
+		Type:               Certificate,
+		Subject:            certificate.Subject.String(),
+		Issuer:             certificate.Issuer.String(),
+		SerialNumber:       formatHex(certificate.SerialNumber.Bytes()),
+		NotBefore:          &notBefore,
+		NotAfter:           &notAfter,
+		IsCA:               certificate.IsCA,
+		DNSNames:           certificate.DNSNames,
+		EmailAddresses:     certificate.EmailAddresses,
+		KeyUsage:           keyUsageNames(certificate.KeyUsage),
+		ExtKeyUsage:        extKeyUsageNames(certificate.ExtKeyUsage),
+		SignatureAlgorithm: certificate.SignatureAlgorithm.String(),
+		PublicKeyAlgorithm: publicKeyDescription(certificate.PublicKey),
+		Fingerprints:       fingerprints(certificate.Raw),
+		publicKey:          certificate.PublicKey,
+	}
+	for _, ip := range certificate.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	for _, uri := range certificate.URIs {
+		info.URIs = append(info.URIs, uri.String())
+	}
+	return info
+}
+
+func csrInfo(csr *x509.CertificateRequest) *Info {
+	info := &Info{
+		Type:               CertificateRequest,
+		Subject:            csr.Subject.String(),
+		DNSNames:           csr.DNSNames,
+		EmailAddresses:     csr.EmailAddresses,
+		SignatureAlgorithm: csr.SignatureAlgorithm.String(),
+		PublicKeyAlgorithm: publicKeyDescription(csr.PublicKey),
+		Fingerprints:       fingerprints(csr.Raw),
+		publicKey:          csr.PublicKey,
+	}
+	for _, ip := range csr.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	for _, uri := range csr.URIs {
+		info.URIs = append(info.URIs, uri.String())
+	}
+	return info
+}
+
+func publicKeyInfo(pemType PEMType, pubKey crypto.PublicKey) *Info {
+	info := &Info{
+		Type:               pemType,
+		PublicKeyAlgorithm: publicKeyDescription(pubKey),
+		publicKey:          pubKey,
+	}
+	// keys are identified by the fingerprint of their SubjectPublicKeyInfo
+	if spki, err := x509.MarshalPKIXPublicKey(pubKey); err == nil {
+		info.Fingerprints = fingerprints(spki)
+	}
+	return info
+}
+
+func fingerprints(der []byte) map[string]string {
+	sha1Sum := sha1.Sum(der)
+	sha256Sum := sha256.Sum256(der)
+	return map[string]string{
+		"sha1":   formatHex(sha1Sum[:]),
+		"sha256": formatHex(sha256Sum[:]),
+	}
+}
+
+// Fingerprint returns the colon separated SHA-256 fingerprint of the DER encoded data.
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return formatHex(sum[:])
+}
+
+func formatHex(b []byte) string {
+	encoded := make([]string, len(b))
+	for i := range b {
+		encoded[i] = strings.ToUpper(hex.EncodeToString(b[i : i+1]))
+	}
+	return strings.Join(encoded, ":")
+}
+
+func publicKeyDescription(pubKey crypto.PublicKey) string {
+	switch key := pubKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA %s", key.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return fmt.Sprintf("%T", pubKey)
+	}
+}
+
+var keyUsages = []struct {
+	usage x509.KeyUsage
+	name  string
+}{
+	{x509.KeyUsageDigitalSignature, "Digital Signature"},
+	{x509.KeyUsageContentCommitment, "Content Commitment"},
+	{x509.KeyUsageKeyEncipherment, "Key Encipherment"},
+	{x509.KeyUsageDataEncipherment, "Data Encipherment"},
+	{x509.KeyUsageKeyAgreement, "Key Agreement"},
+	{x509.KeyUsageCertSign, "Certificate Sign"},
+	{x509.KeyUsageCRLSign, "CRL Sign"},
+	{x509.KeyUsageEncipherOnly, "Encipher Only"},
+	{x509.KeyUsageDecipherOnly, "Decipher Only"},
+}
+
+func keyUsageNames(usage x509.KeyUsage) []string {
+	var names []string
+	for _, keyUsage := range keyUsages {
+		if usage&keyUsage.usage != 0 {
+			names = append(names, keyUsage.name)
+		}
+	}
+	return names
+}
+
+var extKeyUsageNamesByUsage = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:             "Any",
+	x509.ExtKeyUsageServerAuth:      "Server Authentication",
+	x509.ExtKeyUsageClientAuth:      "Client Authentication",
+	x509.ExtKeyUsageCodeSigning:     "Code Signing",
+	x509.ExtKeyUsageEmailProtection: "Email Protection",
+	x509.ExtKeyUsageTimeStamping:    "Time Stamping",
+	x509.ExtKeyUsageOCSPSigning:     "OCSP Signing",
+}
+
+func extKeyUsageNames(usages []x509.ExtKeyUsage) []string {
+	var names []string
+	for _, usage := range usages {
+		name, ok := extKeyUsageNamesByUsage[usage]
+		if !ok {
+			name = fmt.Sprintf("Unknown (%d)", usage)
+		}
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,95 @@
+package cert
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pavlo-v-chernykh/keystore-go/v4"
+)
+
+const jksCertificateType = "X509"
+
+// JKSKeyEntry describes the private key entry of a Java KeyStore.
+type JKSKeyEntry struct {
+	// Alias of the private key entry.
+	Alias string
+	// PrivateKey is the private key belonging to the first certificate of the chain.
+	PrivateKey crypto.Signer
+	// CertificateChain are the DER encoded certificate followed by its issuer chain.
+	CertificateChain [][]byte
+	// Password protects the private key entry. Java expects it to match the store password unless configured otherwise.
+	Password []byte
+}
+
+// EncodeJKSKeyStore encodes a Java KeyStore containing a single private key entry.
+func EncodeJKSKeyStore(entry JKSKeyEntry, password []byte) ([]byte, error) {
+	if entry.PrivateKey == nil || len(entry.CertificateChain) == 0 {
+		return nil, errors.New("keystore requires a private key and a certificate")
+	}
+
+	privateKey, err := x509.MarshalPKCS8PrivateKey(entry.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	keyEntry := keystore.PrivateKeyEntry{
+		CreationTime: time.Now(),
+		PrivateKey:   privateKey,
+	}
+	for _, certificate := range entry.CertificateChain {
+		keyEntry.CertificateChain = append(keyEntry.CertificateChain, keystore.Certificate{
+			Type:    jksCertificateType,
+			Content: certificate,
+		})
+	}
+
+	keyPassword := entry.Password
+	if keyPassword == nil {
+		keyPassword = password
+	}
+
+	ks := keystore.New(keystore.WithMinPasswordLen(1))
+	if err := ks.SetPrivateKeyEntry(entry.Alias, keyEntry, keyPassword); err != nil {
+		return nil, err
+	}
+	return storeJKS(ks, password)
+}
+
+// EncodeJKSTrustStore encodes a Java KeyStore containing the DER encoded certificates as trusted entries.
+// Additional certificates get the alias with a numeric suffix.
+func EncodeJKSTrustStore(alias string, certificates [][]byte, password []byte) ([]byte, error) {
+	if len(certificates) == 0 {
+		return nil, errors.New("truststore requires a certificate")
+	}
+
+	ks := keystore.New(keystore.WithMinPasswordLen(1), keystore.WithOrderedAliases())
+	for i, certificate := range certificates {
+		entryAlias := alias
+		if i > 0 {
+			entryAlias = fmt.Sprintf("%s-%d", alias, i)
+		}
+		err := ks.SetTrustedCertificateEntry(entryAlias, keystore.TrustedCertificateEntry{
+			CreationTime: time.Now(),
+			Certificate: keystore.Certificate{
+				Type:    jksCertificateType,
+				Content: certificate,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return storeJKS(ks, password)
+}
+
+func storeJKS(ks keystore.KeyStore, password []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := ks.Store(&buffer, password); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
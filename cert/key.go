@@ -1,26 +1,113 @@
 package cert
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"os"
+	"strings"
 
 	"github.com/sirupsen/logrus"
+	"github.com/youmark/pkcs8"
 )
 
+// KeyAlgorithm identifies the type of private key which is generated.
+type KeyAlgorithm string
+
+const (
+	RSA       KeyAlgorithm = "rsa"
+	ECDSAP256 KeyAlgorithm = "ecdsa-p256"
+	ECDSAP384 KeyAlgorithm = "ecdsa-p384"
+	Ed25519   KeyAlgorithm = "ed25519"
+)
+
+// KeyFormat identifies the encoding of a private key written to a file.
+type KeyFormat string
+
+const (
+	// Traditional encodes RSA keys as PKCS#1 and ECDSA keys as SEC1.
+	// Ed25519 keys have no traditional format and are always written as PKCS#8.
+	Traditional KeyFormat = "traditional"
+	PKCS8       KeyFormat = "pkcs8"
+)
+
+// ParseKeyFormat returns the KeyFormat for the given name.
+func ParseKeyFormat(name string) (KeyFormat, error) {
+	for _, format := range []KeyFormat{Traditional, PKCS8} {
+		if strings.EqualFold(name, string(format)) {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported key format %s", name)
+}
+
+// KeyAlgorithms lists all supported key algorithms.
+var KeyAlgorithms = []KeyAlgorithm{RSA, ECDSAP256, ECDSAP384, Ed25519}
+
+// ParseKeyAlgorithm returns the KeyAlgorithm for the given name.
+func ParseKeyAlgorithm(name string) (KeyAlgorithm, error) {
+	for _, algorithm := range KeyAlgorithms {
+		if strings.EqualFold(name, string(algorithm)) {
+			return algorithm, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported key algorithm %s", name)
+}
+
+// GenerateKey generates a new private key. The bit size is only used for RSA keys.
+func GenerateKey(algorithm KeyAlgorithm, bits int) (crypto.Signer, error) {
+	switch algorithm {
+	case RSA:
+		return rsa.GenerateKey(rand.Reader, bits)
+	case ECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case ECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case Ed25519:
+		_, privKey, err := ed25519.GenerateKey(rand.Reader)
+		return privKey, err
+	default:
+		return nil, fmt.Errorf("unsupported key algorithm %s", algorithm)
+	}
+}
+
+// PassphraseFunc is called to obtain the passphrase of an encrypted private key.
+// It is only called if the key is actually encrypted.
+type PassphraseFunc func() ([]byte, error)
+
+// KeyOptions describe how a private key is generated and stored.
+type KeyOptions struct {
+	Algorithm KeyAlgorithm
+	Format    KeyFormat
+	// Bits is the size of RSA keys.
+	Bits int
+	// Passphrase encrypts the private key as PKCS#8 if set. Format is ignored in this case.
+	Passphrase []byte
+}
+
 // GenerateRSAKeyPair generates a new RSA key pair of the given bit size.
 func GenerateRSAKeyPair(bits int, privOutfile, pubOutfile string) error {
-	privKey, err := rsa.GenerateKey(rand.Reader, bits)
+	return GenerateKeyPair(KeyOptions{Algorithm: RSA, Format: Traditional, Bits: bits}, privOutfile, pubOutfile, WriteOptions{})
+}
+
+// GenerateKeyPair generates a new key pair and writes it to the given files.
+func GenerateKeyPair(opts KeyOptions, privOutfile, pubOutfile string, writeOpts WriteOptions) error {
+	privKey, err := GenerateKey(opts.Algorithm, opts.Bits)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to generate key")
 		return err
 	}
-	logrus.WithField("name", privOutfile).Debug("Generate private RSA key")
-	if err := WriteToPEMFile(RSAPrivateKey, x509.MarshalPKCS1PrivateKey(privKey), privOutfile); err != nil {
-		logrus.WithError(err).Error("Failed to write private key to file")
+	logrus.WithField("name", privOutfile).WithField("algorithm", opts.Algorithm).Debug("Generate private key")
+	if err := WritePrivateKey(privKey, opts, privOutfile, writeOpts); err != nil {
 		return err
 	}
 
@@ -28,13 +115,110 @@ func GenerateRSAKeyPair(bits int, privOutfile, pubOutfile string) error {
 		return nil
 	}
 
-	return DumpPublicKey(privKey, pubOutfile)
+	return DumpPublicKey(privKey, pubOutfile, writeOpts)
 }
 
-func DumpPublicKey(privateKey *rsa.PrivateKey, filename string) error {
-	pubKey := &privateKey.PublicKey
-	logrus.WithField("name", filename).Debug("Generate public RSA key")
-	if err := WriteToPEMFile(RSAPublicKey, x509.MarshalPKCS1PublicKey(pubKey), filename); err != nil {
+// WritePrivateKey writes the private key in the format and with the passphrase of the options.
+func WritePrivateKey(privKey crypto.Signer, opts KeyOptions, filename string, writeOpts WriteOptions) error {
+	data, err := EncodePrivateKey(privKey, opts)
+	if err != nil {
+		return err
+	}
+	if err := WriteToFile(data, filename, true, writeOpts); err != nil {
+		logrus.WithError(err).Error("Failed to write private key to file")
+		return err
+	}
+	return nil
+}
+
+// EncodePrivateKey returns the PEM encoded private key in the format and with the passphrase of the options.
+func EncodePrivateKey(privKey crypto.Signer, opts KeyOptions) ([]byte, error) {
+	var pemType PEMType
+	var keyBytes []byte
+	var err error
+	if len(opts.Passphrase) > 0 {
+		pemType, keyBytes, err = MarshalEncryptedPrivateKey(privKey, opts.Passphrase)
+	} else {
+		pemType, keyBytes, err = MarshalPrivateKey(privKey, opts.Format)
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Failed to marshal private key")
+		return nil, err
+	}
+	return EncodePEM(pemType, keyBytes), nil
+}
+
+// KeyAlgorithmOf returns the algorithm and, for RSA, the size of the public key.
+func KeyAlgorithmOf(pubKey crypto.PublicKey) (KeyAlgorithm, int, error) {
+	switch key := pubKey.(type) {
+	case *rsa.PublicKey:
+		return RSA, key.N.BitLen(), nil
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return ECDSAP256, 0, nil
+		case elliptic.P384():
+			return ECDSAP384, 0, nil
+		}
+		return "", 0, fmt.Errorf("unsupported elliptic curve %s", key.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return Ed25519, 0, nil
+	default:
+		return "", 0, fmt.Errorf("unsupported public key type %T", pubKey)
+	}
+}
+
+// MarshalPrivateKey encodes the private key in the given format.
+func MarshalPrivateKey(privKey crypto.Signer, format KeyFormat) (PEMType, []byte, error) {
+	if format == PKCS8 {
+		keyBytes, err := x509.MarshalPKCS8PrivateKey(privKey)
+		return PrivateKey, keyBytes, err
+	}
+
+	switch key := privKey.(type) {
+	case *rsa.PrivateKey:
+		return RSAPrivateKey, x509.MarshalPKCS1PrivateKey(key), nil
+	case *ecdsa.PrivateKey:
+		keyBytes, err := x509.MarshalECPrivateKey(key)
+		return ECPrivateKey, keyBytes, err
+	case ed25519.PrivateKey:
+		keyBytes, err := x509.MarshalPKCS8PrivateKey(key)
+		return PrivateKey, keyBytes, err
+	default:
+		return "", nil, fmt.Errorf("unsupported private key type %T", privKey)
+	}
+}
+
+// MarshalEncryptedPrivateKey encodes the private key as PKCS#8 encrypted with the given passphrase.
+func MarshalEncryptedPrivateKey(privKey crypto.Signer, passphrase []byte) (PEMType, []byte, error) {
+	if len(passphrase) == 0 {
+		return "", nil, errors.New("passphrase must not be empty")
+	}
+	keyBytes, err := pkcs8.MarshalPrivateKey(privKey, passphrase, pkcs8.DefaultOpts)
+	return EncryptedPrivateKey, keyBytes, err
+}
+
+// DumpPublicKey writes the public part of the private key to the given file.
+// RSA keys are written in PKCS#1 format, all other keys in PKIX format.
+func DumpPublicKey(privateKey crypto.Signer, filename string, opts WriteOptions) error {
+	pubKey := privateKey.Public()
+	logrus.WithField("name", filename).Debug("Generate public key")
+
+	pemType := PublicKey
+	var keyBytes []byte
+	if rsaKey, ok := pubKey.(*rsa.PublicKey); ok {
+		pemType = RSAPublicKey
+		keyBytes = x509.MarshalPKCS1PublicKey(rsaKey)
+	} else {
+		var err error
+		keyBytes, err = x509.MarshalPKIXPublicKey(pubKey)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to marshal public key")
+			return err
+		}
+	}
+
+	if err := WriteToPEMFile(pemType, keyBytes, filename, opts); err != nil {
 		logrus.WithError(err).Error("Failed to write public key to file")
 		return err
 	}
@@ -42,24 +226,97 @@ func DumpPublicKey(privateKey *rsa.PrivateKey, filename string) error {
 	return nil
 }
 
-func LoadPrivateKey(filename string) (*rsa.PrivateKey, error) {
-	PEMBytes, err := os.ReadFile(filename)
+// LoadPrivateKey reads a private key from a PEM or DER encoded file.
+// The passphrase function is used to decrypt encrypted PKCS#8 keys and may be nil.
+func LoadPrivateKey(filename string, passphrase PassphraseFunc) (crypto.Signer, error) {
+	keyBytes, err := os.ReadFile(filename)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to read private key from file")
 		return nil, err
 	}
 
-	keyBytes, _ := pem.Decode(PEMBytes)
-	if keyBytes == nil {
-		logrus.WithField("keyfile", filename).Error("Failed to decode private key")
-		return nil, errors.New("Failed to decode private key")
+	privKey, err := ParsePrivateKey(keyBytes, passphrase)
+	if err != nil {
+		logrus.WithError(err).WithField("keyfile", filename).Error("Failed to parse private key")
+		return nil, err
 	}
 
-	privKey, err := x509.ParsePKCS1PrivateKey(keyBytes.Bytes)
+	return privKey, nil
+}
+
+// ParsePrivateKey parses a PKCS#1, PKCS#8 or SEC1 private key. The key may be PEM or DER encoded.
+// Encrypted PKCS#8 keys are decrypted with the passphrase returned by the passphrase function.
+func ParsePrivateKey(data []byte, passphrase PassphraseFunc) (crypto.Signer, error) {
+	var privKey crypto.PrivateKey
+	var err error
+
+	if block, _ := pem.Decode(data); block != nil {
+		switch PEMType(block.Type) {
+		case RSAPrivateKey, ECPrivateKey, PrivateKey:
+			privKey, err = parseDERPrivateKey(block.Bytes)
+		case EncryptedPrivateKey:
+			privKey, err = parseEncryptedPrivateKey(block.Bytes, passphrase)
+		default:
+			err = fmt.Errorf("unsupported PEM block type %s", block.Type)
+		}
+	} else {
+		privKey, err = parseDERPrivateKey(data)
+		// DER input carries no hint whether it is encrypted, so only ask for the passphrase if it looks like it
+		if err != nil && isEncryptedPrivateKeyInfo(data) {
+			privKey, err = parseEncryptedPrivateKey(data, passphrase)
+		}
+	}
 	if err != nil {
-		logrus.WithError(err).Error("Failed to parse private key")
 		return nil, err
 	}
 
+	signer, ok := privKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", privKey)
+	}
+
+	return signer, nil
+}
+
+func parseEncryptedPrivateKey(der []byte, passphrase PassphraseFunc) (crypto.PrivateKey, error) {
+	if passphrase == nil {
+		return nil, errors.New("private key is encrypted but no passphrase was provided")
+	}
+	password, err := passphrase()
+	if err != nil {
+		return nil, err
+	}
+	if len(password) == 0 {
+		return nil, errors.New("private key is encrypted but the passphrase is empty")
+	}
+	privKey, err := pkcs8.ParsePKCS8PrivateKey(der, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+	}
 	return privKey, nil
 }
+
+// isEncryptedPrivateKeyInfo reports whether der is a PKCS#8 EncryptedPrivateKeyInfo structure.
+func isEncryptedPrivateKeyInfo(der []byte) bool {
+	var info struct {
+		Algorithm     pkix.AlgorithmIdentifier
+		EncryptedData []byte
+	}
+	rest, err := asn1.Unmarshal(der, &info)
+	return err == nil && len(rest) == 0
+}
+
+// parseDERPrivateKey tries all supported private key encodings, as the PEM block
+// type is not always a reliable hint and DER input has none.
+func parseDERPrivateKey(der []byte) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("Failed to decode private key")
+}
@@ -0,0 +1,144 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/youmark/pkcs8"
+)
+
+func TestParsePrivateKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecSEC1, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPKCS8, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPKCS8, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecEncrypted, err := pkcs8.MarshalPrivateKey(ecKey, []byte("secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{SerialNumber: big.NewInt(1)}, &x509.Certificate{SerialNumber: big.NewInt(1)}, ecKey.Public(), ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passphrase := func(value string) PassphraseFunc {
+		return func() ([]byte, error) {
+			return []byte(value), nil
+		}
+	}
+	noPassphrase := func() ([]byte, error) {
+		return nil, errors.New("passphrase requested for an unencrypted key")
+	}
+
+	tests := []struct {
+		name       string
+		data       []byte
+		passphrase PassphraseFunc
+		want       crypto.Signer
+		wantErr    bool
+	}{
+		{name: "PKCS#1 PEM", data: EncodePEM(RSAPrivateKey, x509.MarshalPKCS1PrivateKey(rsaKey)), passphrase: noPassphrase, want: rsaKey},
+		{name: "PKCS#1 DER", data: x509.MarshalPKCS1PrivateKey(rsaKey), passphrase: noPassphrase, want: rsaKey},
+		{name: "SEC1 PEM", data: EncodePEM(ECPrivateKey, ecSEC1), passphrase: noPassphrase, want: ecKey},
+		{name: "PKCS#8 PEM", data: EncodePEM(PrivateKey, ecPKCS8), passphrase: noPassphrase, want: ecKey},
+		{name: "PKCS#8 DER", data: ecPKCS8, passphrase: noPassphrase, want: ecKey},
+		{name: "Ed25519 PKCS#8 PEM", data: EncodePEM(PrivateKey, edPKCS8), passphrase: noPassphrase, want: edKey},
+		{name: "mismatching PEM type", data: EncodePEM(RSAPrivateKey, ecSEC1), passphrase: noPassphrase, want: ecKey},
+		{name: "encrypted PEM", data: EncodePEM(EncryptedPrivateKey, ecEncrypted), passphrase: passphrase("secret"), want: ecKey},
+		{name: "encrypted DER", data: ecEncrypted, passphrase: passphrase("secret"), want: ecKey},
+		{name: "encrypted PEM with wrong passphrase", data: EncodePEM(EncryptedPrivateKey, ecEncrypted), passphrase: passphrase("wrong"), wantErr: true},
+		{name: "encrypted PEM with empty passphrase", data: EncodePEM(EncryptedPrivateKey, ecEncrypted), passphrase: passphrase(""), wantErr: true},
+		{name: "encrypted PEM without passphrase", data: EncodePEM(EncryptedPrivateKey, ecEncrypted), wantErr: true},
+		{name: "encrypted DER without passphrase", data: ecEncrypted, wantErr: true},
+		{name: "certificate PEM", data: EncodePEM(Certificate, ecPKCS8), passphrase: noPassphrase, wantErr: true},
+		{name: "garbage", data: []byte("not a key"), wantErr: true},
+		{name: "certificate DER", data: certificate, passphrase: noPassphrase, wantErr: true},
+		{name: "corrupt DER", data: ecPKCS8[:len(ecPKCS8)-8], passphrase: noPassphrase, wantErr: true},
+		{name: "garbage with passphrase", data: []byte("not a key"), passphrase: noPassphrase, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePrivateKey(tt.data, tt.passphrase)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				if strings.Contains(err.Error(), "passphrase requested") {
+					t.Errorf("passphrase requested for input which is not an encrypted key: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !PublicKeysEqual(got.Public(), tt.want.Public()) {
+				t.Error("parsed key does not match the encoded key")
+			}
+		})
+	}
+}
+
+func TestEncodePrivateKeyRoundTrip(t *testing.T) {
+	for _, algorithm := range KeyAlgorithms {
+		for _, opts := range []KeyOptions{
+			{Algorithm: algorithm, Format: Traditional, Bits: 2048},
+			{Algorithm: algorithm, Format: PKCS8, Bits: 2048},
+			{Algorithm: algorithm, Bits: 2048, Passphrase: []byte("secret")},
+		} {
+			name := string(algorithm) + "/" + string(opts.Format)
+			if opts.Passphrase != nil {
+				name = string(algorithm) + "/encrypted"
+			}
+			t.Run(name, func(t *testing.T) {
+				privKey, err := GenerateKey(algorithm, opts.Bits)
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, err := EncodePrivateKey(privKey, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := ParsePrivateKey(data, func() ([]byte, error) {
+					return []byte("secret"), nil
+				})
+				if err != nil {
+					t.Fatalf("failed to parse encoded key: %v", err)
+				}
+				if !PublicKeysEqual(got.Public(), privKey.Public()) {
+					t.Error("parsed key does not match the encoded key")
+				}
+			})
+		}
+	}
+}
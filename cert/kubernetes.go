@@ -0,0 +1,145 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Labels added to generated Kubernetes secrets.
+const (
+	KubernetesLabelCertificateUUID = "drivr.com/certificate-uuid"
+	KubernetesLabelIssuer          = "drivr.com/issuer"
+	KubernetesLabelNotAfter        = "drivr.com/not-after"
+)
+
+const kubernetesLabelValueMaxLength = 63
+
+var (
+	invalidKubernetesNameChars       = regexp.MustCompile(`[^a-z0-9.-]+`)
+	invalidKubernetesLabelValueChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+)
+
+// KubernetesSecretOptions holds the metadata of a generated kubernetes.io/tls Secret.
+type KubernetesSecretOptions struct {
+	// Name of the secret. Defaults to the sanitized bundle name.
+	Name string
+	// Namespace of the secret. Omitted if empty.
+	Namespace string
+	// Labels are added to the generated labels.
+	Labels map[string]string
+	// CertificateUUID is the DRIVR UUID of the certificate.
+	CertificateUUID string
+	// Issuer is the name of the DRIVR issuer.
+	Issuer string
+}
+
+type kubernetesObjectMeta struct {
+	Name      string            `json:"name" yaml:"name"`
+	Namespace string            `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+type kubernetesSecret struct {
+	APIVersion string               `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string               `json:"kind" yaml:"kind"`
+	Metadata   kubernetesObjectMeta `json:"metadata" yaml:"metadata"`
+	Type       string               `json:"type" yaml:"type"`
+	Data       map[string]string    `json:"data" yaml:"data"`
+}
+
+// EncodeKubernetesSecret encodes the bundle as kubernetes.io/tls Secret manifest in YAML or JSON.
+// The CA is added as ca.crt if present.
+func EncodeKubernetesSecret(bundle CertificateBundle, asJSON bool) ([]byte, error) {
+	if bundle.PrivateKey == nil {
+		return nil, errors.New("Kubernetes secret requires the private key")
+	}
+	opts := bundle.Kubernetes
+
+	certificate, err := x509.ParseCertificate(bundle.Certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = KubernetesName(bundle.Name)
+	} else if name != KubernetesName(name) {
+		return nil, fmt.Errorf("invalid Kubernetes secret name %s", name)
+	}
+	if name == "" {
+		return nil, errors.New("Kubernetes secret requires a name")
+	}
+
+	labels := map[string]string{
+		KubernetesLabelNotAfter: certificate.NotAfter.UTC().Format("20060102T150405Z"),
+	}
+	if opts.CertificateUUID != "" {
+		labels[KubernetesLabelCertificateUUID] = opts.CertificateUUID
+	}
+	if opts.Issuer != "" {
+		labels[KubernetesLabelIssuer] = KubernetesLabelValue(opts.Issuer)
+	}
+	for key, value := range opts.Labels {
+		labels[key] = value
+	}
+
+	secret := kubernetesSecret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata: kubernetesObjectMeta{
+			Name:      name,
+			Namespace: opts.Namespace,
+			Labels:    labels,
+		},
+		Type: "kubernetes.io/tls",
+		Data: map[string]string{
+			"tls.crt": base64.StdEncoding.EncodeToString(EncodePEM(Certificate, bundle.Certificate)),
+			"tls.key": base64.StdEncoding.EncodeToString(bundle.PrivateKey),
+		},
+	}
+	if bundle.CA != nil {
+		secret.Data["ca.crt"] = base64.StdEncoding.EncodeToString(EncodePEM(Certificate, bundle.CA))
+	}
+
+	if asJSON {
+		data, err := json.MarshalIndent(secret, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	}
+
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(secret); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// KubernetesName converts a name into a valid Kubernetes resource name.
+func KubernetesName(name string) string {
+	name = invalidKubernetesNameChars.ReplaceAllString(strings.ToLower(name), "-")
+	return strings.Trim(name, "-.")
+}
+
+// KubernetesLabelValue converts a value into a valid Kubernetes label value.
+func KubernetesLabelValue(value string) string {
+	value = invalidKubernetesLabelValueChars.ReplaceAllString(value, "-")
+	if len(value) > kubernetesLabelValueMaxLength {
+		value = value[:kubernetesLabelValueMaxLength]
+	}
+	return strings.Trim(value, "-._")
+}
@@ -0,0 +1,164 @@
+package cert
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// OutputFormat determines the shape of a written certificate file.
+type OutputFormat string
+
+const (
+	// Leaf writes only the PEM encoded certificate.
+	Leaf OutputFormat = "leaf"
+	// FullChain writes the PEM encoded certificate followed by the issuer CA.
+	FullChain OutputFormat = "fullchain"
+	// Combined writes the PEM encoded certificate followed by the private key, as used by HAProxy or nginx.
+	Combined OutputFormat = "combined"
+	// DER writes only the DER encoded certificate.
+	DER OutputFormat = "der"
+	// PKCS12 writes the private key, certificate and issuer CA as password protected PKCS#12 file.
+	PKCS12 OutputFormat = "pkcs12"
+	// KubernetesSecret writes a kubernetes.io/tls Secret manifest in YAML.
+	KubernetesSecret OutputFormat = "k8s-secret"
+	// KubernetesSecretJSON writes a kubernetes.io/tls Secret manifest in JSON.
+	KubernetesSecretJSON OutputFormat = "k8s-secret-json"
+)
+
+// OutputFormats lists all supported output formats.
+var OutputFormats = []OutputFormat{Leaf, FullChain, Combined, DER, PKCS12, KubernetesSecret, KubernetesSecretJSON}
+
+// ParseOutputFormat returns the OutputFormat for the given name.
+func ParseOutputFormat(name string) (OutputFormat, error) {
+	for _, format := range OutputFormats {
+		if strings.EqualFold(name, string(format)) {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported output format %s", name)
+}
+
+// NeedsCA reports whether the format includes the issuer CA.
+func (f OutputFormat) NeedsCA() bool {
+	return f == FullChain || f == PKCS12
+}
+
+// NeedsPrivateKey reports whether the format includes the private key.
+func (f OutputFormat) NeedsPrivateKey() bool {
+	return f == Combined || f == PKCS12 || f.IsKubernetesSecret()
+}
+
+// IsKubernetesSecret reports whether the format is a Kubernetes Secret manifest.
+func (f OutputFormat) IsKubernetesSecret() bool {
+	return f == KubernetesSecret || f == KubernetesSecretJSON
+}
+
+// Extension returns the conventional file extension of the format.
+func (f OutputFormat) Extension() string {
+	switch f {
+	case Combined:
+		return "pem"
+	case DER:
+		return "der"
+	case PKCS12:
+		return "p12"
+	case KubernetesSecret:
+		return "yaml"
+	case KubernetesSecretJSON:
+		return "json"
+	default:
+		return "crt"
+	}
+}
+
+// DetectOutputFormat returns the format of a certificate file written in one of the PEM or DER formats.
+func DetectOutputFormat(data []byte) OutputFormat {
+	block, rest := pem.Decode(data)
+	if block == nil {
+		return DER
+	}
+
+	certificates := 0
+	for ; block != nil; block, rest = pem.Decode(rest) {
+		if PEMType(block.Type).IsSecret() {
+			return Combined
+		}
+		if PEMType(block.Type) == Certificate {
+			certificates++
+		}
+	}
+	if certificates > 1 {
+		return FullChain
+	}
+	return Leaf
+}
+
+// CertificateBundle holds everything which may be written alongside a certificate.
+type CertificateBundle struct {
+	// Certificate is the DER encoded certificate.
+	Certificate []byte
+	// CA is the DER encoded issuer CA.
+	CA []byte
+	// PrivateKey is the PEM encoded private key.
+	PrivateKey []byte
+	// Signer is the parsed private key, used for PKCS#12 output.
+	Signer crypto.Signer
+	// Name is the friendly name of the PKCS#12 entries.
+	Name string
+	// Password protects PKCS#12 output.
+	Password []byte
+	// Kubernetes holds the metadata of Kubernetes Secret output.
+	Kubernetes KubernetesSecretOptions
+}
+
+// EncodeCertificate encodes the bundle in the given format.
+func EncodeCertificate(format OutputFormat, bundle CertificateBundle) ([]byte, error) {
+	switch format {
+	case DER:
+		return bundle.Certificate, nil
+	case PKCS12:
+		entry := PKCS12Entry{
+			FriendlyName: bundle.Name,
+			PrivateKey:   bundle.Signer,
+			Certificate:  bundle.Certificate,
+		}
+		if bundle.CA != nil {
+			entry.CACertificates = [][]byte{bundle.CA}
+		}
+		return EncodePKCS12(entry, bundle.Password)
+	case KubernetesSecret, KubernetesSecretJSON:
+		return EncodeKubernetesSecret(bundle, format == KubernetesSecretJSON)
+	}
+
+	var buffer bytes.Buffer
+	buffer.Write(EncodePEM(Certificate, bundle.Certificate))
+
+	switch format {
+	case FullChain:
+		if bundle.CA == nil {
+			return nil, errors.New("fullchain output requires the issuer CA")
+		}
+		buffer.Write(EncodePEM(Certificate, bundle.CA))
+	case Combined:
+		if bundle.PrivateKey == nil {
+			return nil, errors.New("combined output requires the private key")
+		}
+		buffer.Write(bundle.PrivateKey)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// WriteCertificate writes the bundle in the given format to a new file.
+// Files containing the private key are only readable by the owner.
+func WriteCertificate(format OutputFormat, bundle CertificateBundle, filename string, opts WriteOptions) error {
+	data, err := EncodeCertificate(format, bundle)
+	if err != nil {
+		return err
+	}
+	return WriteToFile(data, filename, format.NeedsPrivateKey(), opts)
+}
@@ -0,0 +1,59 @@
+//go:build cgo
+
+package cert
+
+import (
+	"crypto"
+	"errors"
+	"io"
+
+	"github.com/ThalesIgnite/crypto11"
+	"github.com/sirupsen/logrus"
+)
+
+// OpenPKCS11Signer opens the PKCS#11 token selected by the URI and returns the referenced key pair.
+// If the URI does not contain a PIN the pin function is used to obtain it.
+// The returned closer logs out of the token and must be called once the signer is no longer used.
+func OpenPKCS11Signer(ref string, pin PassphraseFunc) (crypto.Signer, io.Closer, error) {
+	uri, err := ParsePKCS11URI(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if uri.Pin == "" && pin != nil {
+		value, err := pin()
+		if err != nil {
+			return nil, nil, err
+		}
+		uri.Pin = string(value)
+	}
+
+	logrus.WithField("module", uri.ModulePath).WithField("token", uri.TokenLabel).Debug("Opening PKCS#11 token")
+	pkcs11Ctx, err := crypto11.Configure(&crypto11.Config{
+		Path:        uri.ModulePath,
+		TokenLabel:  uri.TokenLabel,
+		TokenSerial: uri.TokenSerial,
+		SlotNumber:  uri.SlotID,
+		Pin:         uri.Pin,
+	})
+	if err != nil {
+		logrus.WithError(err).Error("Failed to open PKCS#11 token")
+		return nil, nil, err
+	}
+
+	var label []byte
+	if uri.Object != "" {
+		label = []byte(uri.Object)
+	}
+	signer, err := pkcs11Ctx.FindKeyPair(uri.ID, label)
+	if err == nil && signer == nil {
+		err = errors.New("PKCS#11 key not found")
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("object", uri.Object).Error("Failed to find PKCS#11 key")
+		pkcs11Ctx.Close()
+		return nil, nil, err
+	}
+
+	return signer, pkcs11Ctx, nil
+}
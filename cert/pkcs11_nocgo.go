@@ -0,0 +1,14 @@
+//go:build !cgo
+
+package cert
+
+import (
+	"crypto"
+	"errors"
+	"io"
+)
+
+// OpenPKCS11Signer is not available in builds without cgo.
+func OpenPKCS11Signer(ref string, pin PassphraseFunc) (crypto.Signer, io.Closer, error) {
+	return nil, nil, errors.New("PKCS#11 support requires a build with cgo enabled, the release binaries are built without cgo: use the Docker image or build the client with CGO_ENABLED=1")
+}
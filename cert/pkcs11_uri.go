@@ -0,0 +1,117 @@
+package cert
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	pkcs11Scheme = "pkcs11:"
+	// PKCS11ModuleEnv names the environment variable with the default PKCS#11 module path.
+	PKCS11ModuleEnv = "DRIVR_PKCS11_MODULE"
+)
+
+// PKCS11URI is the subset of an RFC 7512 PKCS#11 URI which is needed to select a private key.
+type PKCS11URI struct {
+	ModulePath  string
+	TokenLabel  string
+	TokenSerial string
+	SlotID      *int
+	Object      string
+	ID          []byte
+	Pin         string
+}
+
+// IsPKCS11URI reports whether the key reference is a pkcs11: URI.
+func IsPKCS11URI(ref string) bool {
+	return strings.HasPrefix(ref, pkcs11Scheme)
+}
+
+// ParsePKCS11URI parses a pkcs11: URI like
+// pkcs11:token=device;object=client?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-source=file:/etc/pin
+func ParsePKCS11URI(ref string) (*PKCS11URI, error) {
+	if !IsPKCS11URI(ref) {
+		return nil, fmt.Errorf("not a PKCS#11 URI: %s", ref)
+	}
+	path, query, _ := strings.Cut(strings.TrimPrefix(ref, pkcs11Scheme), "?")
+
+	uri := &PKCS11URI{}
+	for _, attribute := range strings.Split(path, ";") {
+		if attribute == "" {
+			continue
+		}
+		name, value, err := splitPKCS11Attribute(attribute)
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "token":
+			uri.TokenLabel = value
+		case "serial":
+			uri.TokenSerial = value
+		case "slot-id":
+			slotID, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid PKCS#11 slot-id %s", value)
+			}
+			uri.SlotID = &slotID
+		case "object":
+			uri.Object = value
+		case "id":
+			uri.ID = []byte(value)
+		}
+	}
+
+	for _, attribute := range strings.Split(query, "&") {
+		if attribute == "" {
+			continue
+		}
+		name, value, err := splitPKCS11Attribute(attribute)
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "module-path":
+			uri.ModulePath = value
+		case "pin-value":
+			uri.Pin = value
+		case "pin-source":
+			pin, err := os.ReadFile(strings.TrimPrefix(value, "file:"))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read PKCS#11 pin-source: %w", err)
+			}
+			uri.Pin = strings.TrimRight(string(pin), "\r\n")
+		}
+	}
+
+	if uri.ModulePath == "" {
+		uri.ModulePath = os.Getenv(PKCS11ModuleEnv)
+	}
+	if uri.ModulePath == "" {
+		return nil, fmt.Errorf("PKCS#11 URI has no module-path and %s is not set", PKCS11ModuleEnv)
+	}
+	if uri.TokenLabel == "" && uri.TokenSerial == "" && uri.SlotID == nil {
+		return nil, errors.New("PKCS#11 URI must select a token by token, serial or slot-id")
+	}
+	if uri.Object == "" && len(uri.ID) == 0 {
+		return nil, errors.New("PKCS#11 URI must select a key by object or id")
+	}
+
+	return uri, nil
+}
+
+func splitPKCS11Attribute(attribute string) (string, string, error) {
+	name, value, ok := strings.Cut(attribute, "=")
+	if !ok {
+		return "", "", fmt.Errorf("invalid PKCS#11 URI attribute %s", attribute)
+	}
+	value, err := url.PathUnescape(value)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid PKCS#11 URI attribute %s: %w", attribute, err)
+	}
+	return name, value, nil
+}
@@ -0,0 +1,90 @@
+package cert
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePKCS11URI(t *testing.T) {
+	pinFile := filepath.Join(t.TempDir(), "pin")
+	if err := os.WriteFile(pinFile, []byte("1234\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	slot := func(id int) *int {
+		return &id
+	}
+
+	tests := []struct {
+		name      string
+		ref       string
+		moduleEnv string
+		want      *PKCS11URI
+		wantErr   bool
+	}{
+		{
+			name: "token and object",
+			ref:  "pkcs11:token=device;object=client?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-value=1234",
+			want: &PKCS11URI{ModulePath: "/usr/lib/softhsm/libsofthsm2.so", TokenLabel: "device", Object: "client", Pin: "1234"},
+		},
+		{
+			name: "serial, slot and id",
+			ref:  "pkcs11:serial=42;slot-id=3;id=%01%02?module-path=/lib/p11.so",
+			want: &PKCS11URI{ModulePath: "/lib/p11.so", TokenSerial: "42", SlotID: slot(3), ID: []byte{1, 2}},
+		},
+		{
+			name: "escaped values",
+			ref:  "pkcs11:token=my%20token;object=a%3Bb?module-path=/lib/p11.so",
+			want: &PKCS11URI{ModulePath: "/lib/p11.so", TokenLabel: "my token", Object: "a;b"},
+		},
+		{
+			name: "pin-source",
+			ref:  "pkcs11:token=device;object=client?module-path=/lib/p11.so&pin-source=file:" + pinFile,
+			want: &PKCS11URI{ModulePath: "/lib/p11.so", TokenLabel: "device", Object: "client", Pin: "1234"},
+		},
+		{
+			name:      "module from environment",
+			ref:       "pkcs11:token=device;object=client",
+			moduleEnv: "/env/p11.so",
+			want:      &PKCS11URI{ModulePath: "/env/p11.so", TokenLabel: "device", Object: "client"},
+		},
+		{
+			name:      "module-path overrides environment",
+			ref:       "pkcs11:token=device;object=client?module-path=/lib/p11.so",
+			moduleEnv: "/env/p11.so",
+			want:      &PKCS11URI{ModulePath: "/lib/p11.so", TokenLabel: "device", Object: "client"},
+		},
+		{name: "no module", ref: "pkcs11:token=device;object=client", wantErr: true},
+		{name: "no token", ref: "pkcs11:object=client?module-path=/lib/p11.so", wantErr: true},
+		{name: "no key", ref: "pkcs11:token=device?module-path=/lib/p11.so", wantErr: true},
+		{name: "invalid slot-id", ref: "pkcs11:slot-id=x;object=client?module-path=/lib/p11.so", wantErr: true},
+		{name: "attribute without value", ref: "pkcs11:token;object=client?module-path=/lib/p11.so", wantErr: true},
+		{name: "invalid escape", ref: "pkcs11:token=%zz;object=client?module-path=/lib/p11.so", wantErr: true},
+		{name: "missing pin-source", ref: "pkcs11:token=device;object=client?module-path=/lib/p11.so&pin-source=file:/nonexistent/pin", wantErr: true},
+		{name: "other scheme", ref: "tpm:0x81000000", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(PKCS11ModuleEnv, tt.moduleEnv)
+			got, err := ParsePKCS11URI(tt.ref)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.ModulePath != tt.want.ModulePath || got.TokenLabel != tt.want.TokenLabel || got.TokenSerial != tt.want.TokenSerial ||
+				got.Object != tt.want.Object || !bytes.Equal(got.ID, tt.want.ID) || got.Pin != tt.want.Pin {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if (got.SlotID == nil) != (tt.want.SlotID == nil) || (got.SlotID != nil && *got.SlotID != *tt.want.SlotID) {
+				t.Errorf("got slot-id %v, want %v", got.SlotID, tt.want.SlotID)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"hash"
+	"unicode/utf16"
+
+	"github.com/youmark/pkcs8"
+)
+
+// PKCS#12 files are written in the modern profile understood by Windows 10+, OpenSSL 1.1+ and Java 8u301+:
+// the private key is shrouded with PBES2 (PBKDF2-HMAC-SHA256, AES-256-CBC) and the file is
+// integrity protected with HMAC-SHA256. Certificates are stored unencrypted.
+const pkcs12MacIterations = 2048
+
+var (
+	oidDataContentType         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPKCS8ShroudedKeyBag     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag                 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidCertTypeX509Certificate = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidFriendlyName            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidLocalKeyID              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+	oidSHA256                  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+)
+
+type pfxPdu struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue     `asn1:"tag:0,explicit"`
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+// PKCS12Entry describes the contents of a PKCS#12 file.
+type PKCS12Entry struct {
+	// FriendlyName is shown for the private key and certificate when importing the file.
+	FriendlyName string
+	// PrivateKey is the private key belonging to Certificate.
+	PrivateKey crypto.Signer
+	// Certificate is the DER encoded certificate.
+	Certificate []byte
+	// CACertificates are the DER encoded certificates of the issuer chain.
+	CACertificates [][]byte
+	// CAFriendlyName is shown for the CA certificates. Defaults to FriendlyName with a " CA" suffix.
+	CAFriendlyName string
+}
+
+// EncodePKCS12 encodes the entry as a password protected PKCS#12 file.
+func EncodePKCS12(entry PKCS12Entry, password []byte) ([]byte, error) {
+	if entry.PrivateKey == nil || entry.Certificate == nil {
+		return nil, errors.New("PKCS#12 file requires a private key and a certificate")
+	}
+	if len(password) == 0 {
+		return nil, errors.New("PKCS#12 password must not be empty")
+	}
+
+	localKeyID := sha1.Sum(entry.Certificate)
+	keyAttributes, err := pkcs12Attributes(entry.FriendlyName, localKeyID[:])
+	if err != nil {
+		return nil, err
+	}
+
+	caFriendlyName := entry.CAFriendlyName
+	if caFriendlyName == "" && entry.FriendlyName != "" {
+		caFriendlyName = entry.FriendlyName + " CA"
+	}
+	caAttributes, err := pkcs12Attributes(caFriendlyName, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	certBags := make([]safeBag, 0, len(entry.CACertificates)+1)
+	bag, err := makeCertBag(entry.Certificate, keyAttributes)
+	if err != nil {
+		return nil, err
+	}
+	certBags = append(certBags, bag)
+	for _, ca := range entry.CACertificates {
+		bag, err := makeCertBag(ca, caAttributes)
+		if err != nil {
+			return nil, err
+		}
+		certBags = append(certBags, bag)
+	}
+
+	shroudedKey, err := pkcs8.MarshalPrivateKey(entry.PrivateKey, password, pkcs8.DefaultOpts)
+	if err != nil {
+		return nil, err
+	}
+	keyBag := safeBag{
+		ID:         oidPKCS8ShroudedKeyBag,
+		Value:      explicitContent(shroudedKey),
+		Attributes: keyAttributes,
+	}
+
+	certContents, err := makeDataContentInfo(certBags)
+	if err != nil {
+		return nil, err
+	}
+	keyContents, err := makeDataContentInfo([]safeBag{keyBag})
+	if err != nil {
+		return nil, err
+	}
+
+	authenticatedSafe, err := asn1.Marshal([]contentInfo{certContents, keyContents})
+	if err != nil {
+		return nil, err
+	}
+
+	pfx := pfxPdu{Version: 3}
+	pfx.AuthSafe.ContentType = oidDataContentType
+	if pfx.AuthSafe.Content, err = explicitOctetString(authenticatedSafe); err != nil {
+		return nil, err
+	}
+	if pfx.MacData, err = computeMac(authenticatedSafe, password); err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(pfx)
+}
+
+func makeCertBag(certificate []byte, attributes []pkcs12Attribute) (safeBag, error) {
+	data, err := asn1.Marshal(certBag{ID: oidCertTypeX509Certificate, Data: certificate})
+	if err != nil {
+		return safeBag{}, err
+	}
+	return safeBag{
+		ID:         oidCertBag,
+		Value:      explicitContent(data),
+		Attributes: attributes,
+	}, nil
+}
+
+func makeDataContentInfo(bags []safeBag) (contentInfo, error) {
+	data, err := asn1.Marshal(bags)
+	if err != nil {
+		return contentInfo{}, err
+	}
+	content, err := explicitOctetString(data)
+	if err != nil {
+		return contentInfo{}, err
+	}
+	return contentInfo{ContentType: oidDataContentType, Content: content}, nil
+}
+
+func pkcs12Attributes(friendlyName string, localKeyID []byte) ([]pkcs12Attribute, error) {
+	var attributes []pkcs12Attribute
+	if friendlyName != "" {
+		value, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagBMPString, Bytes: bmpString(friendlyName)})
+		if err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, pkcs12Attribute{ID: oidFriendlyName, Value: setOf(value)})
+	}
+	if localKeyID != nil {
+		value, err := asn1.Marshal(localKeyID)
+		if err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, pkcs12Attribute{ID: oidLocalKeyID, Value: setOf(value)})
+	}
+	return attributes, nil
+}
+
+func computeMac(data, password []byte) (macData, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return macData{}, err
+	}
+
+	key := pkcs12KDF(sha256.New, 64, salt, bmpPassword(password), pkcs12MacIterations, 3, sha256.Size)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+
+	return macData{
+		Mac: digestInfo{
+			Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+			Digest:    mac.Sum(nil),
+		},
+		MacSalt:    salt,
+		Iterations: pkcs12MacIterations,
+	}, nil
+}
+
+// pkcs12KDF derives key material as described in RFC 7292, appendix B.2.
+func pkcs12KDF(newHash func() hash.Hash, v int, salt, password []byte, iterations int, id byte, size int) []byte {
+	fill := func(data []byte) []byte {
+		if len(data) == 0 {
+			return nil
+		}
+		out := make([]byte, v*((len(data)+v-1)/v))
+		for i := range out {
+			out[i] = data[i%len(data)]
+		}
+		return out
+	}
+
+	d := make([]byte, v)
+	for i := range d {
+		d[i] = id
+	}
+	i := append(fill(salt), fill(password)...)
+
+	var result []byte
+	for len(result) < size {
+		h := newHash()
+		h.Write(d)
+		h.Write(i)
+		a := h.Sum(nil)
+		for n := 1; n < iterations; n++ {
+			h.Reset()
+			h.Write(a)
+			a = h.Sum(a[:0])
+		}
+		result = append(result, a...)
+
+		if len(result) < size {
+			b := make([]byte, v)
+			for k := range b {
+				b[k] = a[k%len(a)]
+			}
+			for j := 0; j < len(i); j += v {
+				carry := 1
+				for k := v - 1; k >= 0; k-- {
+					sum := int(i[j+k]) + int(b[k]) + carry
+					i[j+k] = byte(sum)
+					carry = sum >> 8
+				}
+			}
+		}
+	}
+	return result[:size]
+}
+
+func bmpString(s string) []byte {
+	encoded := utf16.Encode([]rune(s))
+	out := make([]byte, 0, 2*len(encoded))
+	for _, r := range encoded {
+		out = append(out, byte(r>>8), byte(r))
+	}
+	return out
+}
+
+// bmpPassword returns the null terminated BMPString representation of the password used by the PKCS#12 KDF.
+func bmpPassword(password []byte) []byte {
+	return append(bmpString(string(password)), 0, 0)
+}
+
+func explicitContent(der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der}
+}
+
+func explicitOctetString(data []byte) (asn1.RawValue, error) {
+	der, err := asn1.Marshal(data)
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	return explicitContent(der), nil
+}
+
+func setOf(der []byte) asn1.RawValue {
+	return asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: der}
+}
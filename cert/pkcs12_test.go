@@ -0,0 +1,167 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// newTestCertificate returns a DER encoded certificate signed by the parent, or self-signed if parent is nil.
+func newTestCertificate(t *testing.T, commonName string, key, parentKey *ecdsa.PrivateKey, parent *x509.Certificate) []byte {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+	if parent == nil {
+		parent = template
+		parentKey = key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestEncodePKCS12(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caDER := newTestCertificate(t, "Test CA", caKey, nil, nil)
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafDER := newTestCertificate(t, "gateway", key, caKey, ca)
+
+	tests := []struct {
+		name        string
+		entry       PKCS12Entry
+		wantName    string
+		wantCAName  string
+		wantCACerts int
+	}{
+		{
+			name:        "friendly names",
+			entry:       PKCS12Entry{FriendlyName: "gw", PrivateKey: key, Certificate: leafDER, CACertificates: [][]byte{caDER}},
+			wantName:    "gw",
+			wantCAName:  "gw CA",
+			wantCACerts: 1,
+		},
+		{
+			name:        "CA friendly name",
+			entry:       PKCS12Entry{FriendlyName: "gw", PrivateKey: key, Certificate: leafDER, CACertificates: [][]byte{caDER}, CAFriendlyName: "DRIVR CA"},
+			wantName:    "gw",
+			wantCAName:  "DRIVR CA",
+			wantCACerts: 1,
+		},
+		{
+			name:       "non-ASCII friendly name",
+			entry:      PKCS12Entry{FriendlyName: "Gerät 1", PrivateKey: key, Certificate: leafDER},
+			wantName:   "Gerät 1",
+			wantCAName: "Gerät 1 CA",
+		},
+		{
+			name:        "without friendly name",
+			entry:       PKCS12Entry{PrivateKey: key, Certificate: leafDER, CACertificates: [][]byte{caDER}},
+			wantCACerts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := EncodePKCS12(tt.entry, []byte("secret"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			privateKey, certificate, caCertificates, err := pkcs12.DecodeChain(data, "secret")
+			if err != nil {
+				t.Fatalf("failed to decode PKCS#12 file: %v", err)
+			}
+			if !key.Equal(privateKey) {
+				t.Error("decoded private key does not match")
+			}
+			if !bytes.Equal(certificate.Raw, leafDER) {
+				t.Error("decoded certificate does not match")
+			}
+			if len(caCertificates) != tt.wantCACerts {
+				t.Fatalf("got %d CA certificates, want %d", len(caCertificates), tt.wantCACerts)
+			}
+			if tt.wantCACerts > 0 && !bytes.Equal(caCertificates[0].Raw, caDER) {
+				t.Error("decoded CA certificate does not match")
+			}
+
+			if _, _, _, err := pkcs12.DecodeChain(data, "wrong"); !errors.Is(err, pkcs12.ErrIncorrectPassword) {
+				t.Errorf("decoding with the wrong password returned %v", err)
+			}
+
+			blocks, err := pkcs12.ToPEM(data, "secret")
+			if err != nil {
+				t.Fatalf("failed to convert PKCS#12 file: %v", err)
+			}
+			var keyID, leafID string
+			for _, block := range blocks {
+				switch {
+				case block.Type == "CERTIFICATE" && bytes.Equal(block.Bytes, leafDER):
+					leafID = block.Headers["localKeyId"]
+					if got := block.Headers["friendlyName"]; got != tt.wantName {
+						t.Errorf("certificate has friendly name %q, want %q", got, tt.wantName)
+					}
+				case block.Type == "CERTIFICATE":
+					if got := block.Headers["friendlyName"]; got != tt.wantCAName {
+						t.Errorf("CA certificate has friendly name %q, want %q", got, tt.wantCAName)
+					}
+					if _, ok := block.Headers["localKeyId"]; ok {
+						t.Error("CA certificate must not have a local key ID")
+					}
+				default:
+					keyID = block.Headers["localKeyId"]
+					if got := block.Headers["friendlyName"]; got != tt.wantName {
+						t.Errorf("private key has friendly name %q, want %q", got, tt.wantName)
+					}
+				}
+			}
+			if keyID == "" || keyID != leafID {
+				t.Errorf("local key IDs of key %q and certificate %q do not match", keyID, leafID)
+			}
+		})
+	}
+}
+
+func TestEncodePKCS12Invalid(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate := newTestCertificate(t, "gateway", key, nil, nil)
+
+	if _, err := EncodePKCS12(PKCS12Entry{PrivateKey: key, Certificate: certificate}, nil); err == nil {
+		t.Error("expected an error for an empty password")
+	}
+	if _, err := EncodePKCS12(PKCS12Entry{Certificate: certificate}, []byte("secret")); err == nil {
+		t.Error("expected an error without private key")
+	}
+	if _, err := EncodePKCS12(PKCS12Entry{PrivateKey: key}, []byte("secret")); err == nil {
+		t.Error("expected an error without certificate")
+	}
+}
@@ -0,0 +1,34 @@
+package cert
+
+import (
+	"crypto"
+	"io"
+)
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// IsFileKey reports whether the key reference points to a private key file rather than a hardware-backed key.
+func IsFileKey(ref string) bool {
+	return !IsPKCS11URI(ref) && !IsTPMURI(ref)
+}
+
+// OpenSigner returns the private key referenced by ref, which is either the path to a
+// private key file, a pkcs11: URI or a tpm: URI. The passphrase function is used for encrypted key files,
+// the pin function for PKCS#11 tokens. The returned closer releases hardware resources
+// and must be called once the signer is no longer used.
+func OpenSigner(ref string, passphrase, pin PassphraseFunc) (crypto.Signer, io.Closer, error) {
+	if IsPKCS11URI(ref) {
+		return OpenPKCS11Signer(ref, pin)
+	}
+	if IsTPMURI(ref) {
+		return OpenTPMSigner(ref)
+	}
+
+	privKey, err := LoadPrivateKey(ref, passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	return privKey, nopCloser{}, nil
+}
@@ -0,0 +1,300 @@
+//go:build !windows
+
+package cert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/linuxtpm"
+	"github.com/google/go-tpm/tpm2/transport/linuxudstpm"
+	"github.com/sirupsen/logrus"
+)
+
+type tpmSigner struct {
+	tpm    transport.TPMCloser
+	handle tpm2.NamedHandle
+	public crypto.PublicKey
+}
+
+func openTPM(device string) (transport.TPMCloser, error) {
+	fi, err := os.Stat(device)
+	if err != nil {
+		return nil, err
+	}
+	if fi.Mode()&os.ModeSocket != 0 {
+		return linuxudstpm.Open(device)
+	}
+	return linuxtpm.Open(device)
+}
+
+// OpenTPMSigner returns the key persisted at the handle of the tpm: URI.
+// The returned closer closes the TPM connection and must be called once the signer is no longer used.
+func OpenTPMSigner(ref string) (crypto.Signer, io.Closer, error) {
+	uri, err := ParseTPMURI(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logrus.WithField("device", uri.Device).WithField("handle", fmt.Sprintf("0x%x", uri.Handle)).Debug("Opening TPM key")
+	tpm, err := openTPM(uri.Device)
+	if err != nil {
+		logrus.WithError(err).WithField("device", uri.Device).Error("Failed to open TPM")
+		return nil, nil, err
+	}
+
+	signer, err := newTPMSigner(tpm, tpm2.TPMHandle(uri.Handle))
+	if err != nil {
+		tpm.Close()
+		return nil, nil, err
+	}
+	return signer, signer, nil
+}
+
+// TPMKeyExists reports whether a key is persisted at the handle of the tpm: URI.
+func TPMKeyExists(ref string) (bool, error) {
+	uri, err := ParseTPMURI(ref)
+	if err != nil {
+		return false, err
+	}
+	tpm, err := openTPM(uri.Device)
+	if err != nil {
+		return false, err
+	}
+	defer tpm.Close()
+
+	_, err = tpm2.ReadPublic{ObjectHandle: tpm2.TPMHandle(uri.Handle)}.Execute(tpm)
+	if errors.Is(err, tpm2.TPMRCHandle) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GenerateTPMKey creates a new signing key in the TPM below the owner storage root key
+// and persists it at the handle of the tpm: URI. RSA and ECDSA keys are supported.
+func GenerateTPMKey(ref string, algorithm KeyAlgorithm, bits int) (crypto.Signer, io.Closer, error) {
+	uri, err := ParseTPMURI(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	template, err := tpmKeyTemplate(algorithm, bits)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tpm, err := openTPM(uri.Device)
+	if err != nil {
+		logrus.WithError(err).WithField("device", uri.Device).Error("Failed to open TPM")
+		return nil, nil, err
+	}
+
+	if err := createPersistentTPMKey(tpm, template, tpm2.TPMHandle(uri.Handle)); err != nil {
+		logrus.WithError(err).Error("Failed to create TPM key")
+		tpm.Close()
+		return nil, nil, err
+	}
+
+	signer, err := newTPMSigner(tpm, tpm2.TPMHandle(uri.Handle))
+	if err != nil {
+		tpm.Close()
+		return nil, nil, err
+	}
+	return signer, signer, nil
+}
+
+func createPersistentTPMKey(tpm transport.TPM, template tpm2.TPMTPublic, persistentHandle tpm2.TPMHandle) error {
+	srk, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(tpm)
+	if err != nil {
+		return fmt.Errorf("failed to create storage root key: %w", err)
+	}
+	defer tpm2.FlushContext{FlushHandle: srk.ObjectHandle}.Execute(tpm) //nolint:errcheck
+
+	parent := tpm2.AuthHandle{
+		Handle: srk.ObjectHandle,
+		Name:   srk.Name,
+		Auth:   tpm2.PasswordAuth(nil),
+	}
+	key, err := tpm2.Create{
+		ParentHandle: parent,
+		InPublic:     tpm2.New2B(template),
+	}.Execute(tpm)
+	if err != nil {
+		return fmt.Errorf("failed to create key: %w", err)
+	}
+
+	loaded, err := tpm2.Load{
+		ParentHandle: parent,
+		InPrivate:    key.OutPrivate,
+		InPublic:     key.OutPublic,
+	}.Execute(tpm)
+	if err != nil {
+		return fmt.Errorf("failed to load key: %w", err)
+	}
+	defer tpm2.FlushContext{FlushHandle: loaded.ObjectHandle}.Execute(tpm) //nolint:errcheck
+
+	_, err = tpm2.EvictControl{
+		Auth:             tpm2.TPMRHOwner,
+		ObjectHandle:     tpm2.NamedHandle{Handle: loaded.ObjectHandle, Name: loaded.Name},
+		PersistentHandle: persistentHandle,
+	}.Execute(tpm)
+	if err != nil {
+		return fmt.Errorf("failed to persist key at handle 0x%x: %w", uint32(persistentHandle), err)
+	}
+
+	return nil
+}
+
+func tpmKeyTemplate(algorithm KeyAlgorithm, bits int) (tpm2.TPMTPublic, error) {
+	attributes := tpm2.TPMAObject{
+		FixedTPM:            true,
+		FixedParent:         true,
+		SensitiveDataOrigin: true,
+		UserWithAuth:        true,
+		SignEncrypt:         true,
+	}
+
+	switch algorithm {
+	case RSA:
+		return tpm2.TPMTPublic{
+			Type:             tpm2.TPMAlgRSA,
+			NameAlg:          tpm2.TPMAlgSHA256,
+			ObjectAttributes: attributes,
+			Parameters: tpm2.NewTPMUPublicParms(tpm2.TPMAlgRSA, &tpm2.TPMSRSAParms{
+				Scheme:  tpm2.TPMTRSAScheme{Scheme: tpm2.TPMAlgNull},
+				KeyBits: tpm2.TPMKeyBits(bits),
+			}),
+			Unique: tpm2.NewTPMUPublicID(tpm2.TPMAlgRSA, &tpm2.TPM2BPublicKeyRSA{}),
+		}, nil
+	case ECDSAP256, ECDSAP384:
+		curve := tpm2.TPMECCNistP256
+		if algorithm == ECDSAP384 {
+			curve = tpm2.TPMECCNistP384
+		}
+		return tpm2.TPMTPublic{
+			Type:             tpm2.TPMAlgECC,
+			NameAlg:          tpm2.TPMAlgSHA256,
+			ObjectAttributes: attributes,
+			Parameters: tpm2.NewTPMUPublicParms(tpm2.TPMAlgECC, &tpm2.TPMSECCParms{
+				CurveID: curve,
+				Scheme:  tpm2.TPMTECCScheme{Scheme: tpm2.TPMAlgNull},
+			}),
+			Unique: tpm2.NewTPMUPublicID(tpm2.TPMAlgECC, &tpm2.TPMSECCPoint{}),
+		}, nil
+	default:
+		return tpm2.TPMTPublic{}, fmt.Errorf("key algorithm %s is not supported by the TPM backend", algorithm)
+	}
+}
+
+func newTPMSigner(tpm transport.TPMCloser, handle tpm2.TPMHandle) (*tpmSigner, error) {
+	readPublic, err := tpm2.ReadPublic{ObjectHandle: handle}.Execute(tpm)
+	if err != nil {
+		logrus.WithError(err).WithField("handle", fmt.Sprintf("0x%x", uint32(handle))).Error("Failed to read TPM key")
+		return nil, err
+	}
+	public, err := readPublic.OutPublic.Contents()
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := tpm2.Pub(*public)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tpmSigner{
+		tpm:    tpm,
+		handle: tpm2.NamedHandle{Handle: handle, Name: readPublic.Name},
+		public: pubKey,
+	}, nil
+}
+
+func (s *tpmSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+func (s *tpmSigner) Close() error {
+	return s.tpm.Close()
+}
+
+func (s *tpmSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hashAlg, err := tpmHashAlgorithm(opts.HashFunc())
+	if err != nil {
+		return nil, err
+	}
+
+	var scheme tpm2.TPMAlgID
+	switch s.public.(type) {
+	case *ecdsa.PublicKey:
+		scheme = tpm2.TPMAlgECDSA
+	case *rsa.PublicKey:
+		scheme = tpm2.TPMAlgRSASSA
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			scheme = tpm2.TPMAlgRSAPSS
+		}
+	default:
+		return nil, fmt.Errorf("unsupported TPM key type %T", s.public)
+	}
+
+	rsp, err := tpm2.Sign{
+		KeyHandle: s.handle,
+		Digest:    tpm2.TPM2BDigest{Buffer: digest},
+		InScheme: tpm2.TPMTSigScheme{
+			Scheme:  scheme,
+			Details: tpm2.NewTPMUSigScheme(scheme, &tpm2.TPMSSchemeHash{HashAlg: hashAlg}),
+		},
+		Validation: tpm2.TPMTTKHashCheck{Tag: tpm2.TPMSTHashCheck, Hierarchy: tpm2.TPMRHNull},
+	}.Execute(s.tpm)
+	if err != nil {
+		return nil, fmt.Errorf("TPM failed to sign: %w", err)
+	}
+
+	switch scheme {
+	case tpm2.TPMAlgECDSA:
+		signature, err := rsp.Signature.Signature.ECDSA()
+		if err != nil {
+			return nil, err
+		}
+		return asn1.Marshal(struct{ R, S *big.Int }{
+			R: new(big.Int).SetBytes(signature.SignatureR.Buffer),
+			S: new(big.Int).SetBytes(signature.SignatureS.Buffer),
+		})
+	case tpm2.TPMAlgRSAPSS:
+		signature, err := rsp.Signature.Signature.RSAPSS()
+		if err != nil {
+			return nil, err
+		}
+		return signature.Sig.Buffer, nil
+	default:
+		signature, err := rsp.Signature.Signature.RSASSA()
+		if err != nil {
+			return nil, err
+		}
+		return signature.Sig.Buffer, nil
+	}
+}
+
+func tpmHashAlgorithm(hash crypto.Hash) (tpm2.TPMIAlgHash, error) {
+	switch hash {
+	case crypto.SHA1:
+		return tpm2.TPMAlgSHA1, nil
+	case crypto.SHA256:
+		return tpm2.TPMAlgSHA256, nil
+	case crypto.SHA384:
+		return tpm2.TPMAlgSHA384, nil
+	case crypto.SHA512:
+		return tpm2.TPMAlgSHA512, nil
+	default:
+		return 0, fmt.Errorf("hash function %s is not supported by the TPM", hash)
+	}
+}
@@ -0,0 +1,66 @@
+package cert
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	tpmScheme = "tpm:"
+	// TPMDeviceEnv names the environment variable with the default TPM device.
+	TPMDeviceEnv     = "DRIVR_TPM_DEVICE"
+	defaultTPMDevice = "/dev/tpmrm0"
+
+	tpmPersistentFirst = 0x81000000
+	tpmPersistentLast  = 0x81FFFFFF
+)
+
+// TPMKeyURI references a key persisted in a TPM 2.0.
+type TPMKeyURI struct {
+	// Device is the TPM character device or the Unix socket of a TPM simulator like swtpm.
+	Device string
+	// Handle is the persistent handle of the key.
+	Handle uint32
+}
+
+// IsTPMURI reports whether the key reference is a tpm: URI.
+func IsTPMURI(ref string) bool {
+	return strings.HasPrefix(ref, tpmScheme)
+}
+
+// ParseTPMURI parses a tpm: URI like tpm:0x81000100?device=/dev/tpmrm0.
+func ParseTPMURI(ref string) (*TPMKeyURI, error) {
+	if !IsTPMURI(ref) {
+		return nil, fmt.Errorf("not a TPM URI: %s", ref)
+	}
+	handle, query, _ := strings.Cut(strings.TrimPrefix(ref, tpmScheme), "?")
+
+	value, err := strconv.ParseUint(handle, 0, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TPM handle %s", handle)
+	}
+	if value < tpmPersistentFirst || value > tpmPersistentLast {
+		return nil, fmt.Errorf("TPM handle %s is not a persistent handle", handle)
+	}
+
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TPM URI %s: %w", ref, err)
+	}
+
+	uri := &TPMKeyURI{
+		Device: params.Get("device"),
+		Handle: uint32(value),
+	}
+	if uri.Device == "" {
+		uri.Device = os.Getenv(TPMDeviceEnv)
+	}
+	if uri.Device == "" {
+		uri.Device = defaultTPMDevice
+	}
+
+	return uri, nil
+}
@@ -0,0 +1,46 @@
+package cert
+
+import "testing"
+
+func TestParseTPMURI(t *testing.T) {
+	tests := []struct {
+		name      string
+		ref       string
+		deviceEnv string
+		want      TPMKeyURI
+		wantErr   bool
+	}{
+		{name: "hex handle", ref: "tpm:0x81000100", want: TPMKeyURI{Device: defaultTPMDevice, Handle: 0x81000100}},
+		{name: "decimal handle", ref: "tpm:2164260864", want: TPMKeyURI{Device: defaultTPMDevice, Handle: 0x81000000}},
+		{name: "last persistent handle", ref: "tpm:0x81FFFFFF", want: TPMKeyURI{Device: defaultTPMDevice, Handle: 0x81FFFFFF}},
+		{name: "device", ref: "tpm:0x81000100?device=/run/swtpm.sock", want: TPMKeyURI{Device: "/run/swtpm.sock", Handle: 0x81000100}},
+		{name: "device from environment", ref: "tpm:0x81000100", deviceEnv: "/dev/tpm0", want: TPMKeyURI{Device: "/dev/tpm0", Handle: 0x81000100}},
+		{name: "device overrides environment", ref: "tpm:0x81000100?device=/dev/tpmrm1", deviceEnv: "/dev/tpm0", want: TPMKeyURI{Device: "/dev/tpmrm1", Handle: 0x81000100}},
+		{name: "transient handle", ref: "tpm:0x80000000", wantErr: true},
+		{name: "handle after persistent range", ref: "tpm:0x82000000", wantErr: true},
+		{name: "handle too large", ref: "tpm:0x100000000", wantErr: true},
+		{name: "invalid handle", ref: "tpm:key", wantErr: true},
+		{name: "empty handle", ref: "tpm:", wantErr: true},
+		{name: "invalid query", ref: "tpm:0x81000100?device=%zz", wantErr: true},
+		{name: "other scheme", ref: "pkcs11:token=device;object=client", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(TPMDeviceEnv, tt.deviceEnv)
+			got, err := ParseTPMURI(tt.ref)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
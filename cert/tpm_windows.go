@@ -0,0 +1,24 @@
+package cert
+
+import (
+	"crypto"
+	"errors"
+	"io"
+)
+
+var errTPMUnsupported = errors.New("TPM keys are not supported on Windows")
+
+// OpenTPMSigner is not available on Windows.
+func OpenTPMSigner(ref string) (crypto.Signer, io.Closer, error) {
+	return nil, nil, errTPMUnsupported
+}
+
+// TPMKeyExists is not available on Windows.
+func TPMKeyExists(ref string) (bool, error) {
+	return false, errTPMUnsupported
+}
+
+// GenerateTPMKey is not available on Windows.
+func GenerateTPMKey(ref string, algorithm KeyAlgorithm, bits int) (crypto.Signer, io.Closer, error) {
+	return nil, nil, errTPMUnsupported
+}
@@ -0,0 +1,103 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// VerifyOptions configure which checks Verify performs.
+type VerifyOptions struct {
+	// Roots holds the issuer CA certificates the certificate has to chain to.
+	Roots *x509.CertPool
+	// Intermediates holds optional intermediate CA certificates.
+	Intermediates *x509.CertPool
+	// Usage is the extended key usage the certificate must allow.
+	Usage x509.ExtKeyUsage
+	// PrivateKey is checked to match the certificate if set.
+	PrivateKey crypto.Signer
+	// CurrentTime defaults to the current time.
+	CurrentTime time.Time
+}
+
+// VerifyResult is the outcome of a single check performed by Verify.
+type VerifyResult struct {
+	Check string
+	Err   error
+}
+
+// Verify checks that the certificate chains to the given roots, is within its validity window,
+// allows the requested usage and matches the private key. All checks are performed and their
+// results returned, the error is set if any check failed.
+func Verify(certificate *x509.Certificate, opts VerifyOptions) ([]VerifyResult, error) {
+	now := opts.CurrentTime
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	results := []VerifyResult{
+		{Check: "validity", Err: verifyValidity(certificate, now)},
+		{Check: "chain", Err: verifyChain(certificate, opts, now)},
+		{Check: "usage", Err: verifyUsage(certificate, opts.Usage)},
+	}
+	if opts.PrivateKey != nil {
+		var err error
+		if !PublicKeysEqual(opts.PrivateKey.Public(), certificate.PublicKey) {
+			err = errors.New("certificate does not match the private key")
+		}
+		results = append(results, VerifyResult{Check: "private key", Err: err})
+	}
+
+	for _, result := range results {
+		if result.Err != nil {
+			return results, errors.New("certificate verification failed")
+		}
+	}
+	return results, nil
+}
+
+func verifyValidity(certificate *x509.Certificate, now time.Time) error {
+	if now.Before(certificate.NotBefore) {
+		return fmt.Errorf("certificate is not valid before %s", certificate.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(certificate.NotAfter) {
+		return fmt.Errorf("certificate expired at %s", certificate.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// verifyChain checks the chain at a time within the certificate's validity, so an expired
+// leaf is only reported by the validity check.
+func verifyChain(certificate *x509.Certificate, opts VerifyOptions, now time.Time) error {
+	if opts.Roots == nil {
+		return errors.New("no CA certificate given")
+	}
+	chainTime := now
+	if chainTime.Before(certificate.NotBefore) {
+		chainTime = certificate.NotBefore
+	}
+	if chainTime.After(certificate.NotAfter) {
+		chainTime = certificate.NotAfter
+	}
+	_, err := certificate.Verify(x509.VerifyOptions{
+		Roots:         opts.Roots,
+		Intermediates: opts.Intermediates,
+		CurrentTime:   chainTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err
+}
+
+func verifyUsage(certificate *x509.Certificate, usage x509.ExtKeyUsage) error {
+	// certificates without extended key usages may be used for any purpose
+	if len(certificate.ExtKeyUsage) == 0 || slices.Contains(certificate.ExtKeyUsage, x509.ExtKeyUsageAny) {
+		return nil
+	}
+	if !slices.Contains(certificate.ExtKeyUsage, usage) {
+		return fmt.Errorf("certificate does not allow %s", extKeyUsageNamesByUsage[usage])
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package cert
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WriteOptions controls how existing files are treated by WriteToFile.
+type WriteOptions struct {
+	// Force allows replacing existing files.
+	Force bool
+	// Backup keeps a timestamped copy of replaced files.
+	Backup bool
+}
+
+// CheckWritable returns an error if the file exists and may not be replaced.
+func CheckWritable(filename string, opts WriteOptions) error {
+	if _, err := os.Lstat(filename); err == nil && !opts.Force {
+		return fmt.Errorf("file %s already exists", filename)
+	}
+	return nil
+}
+
+// WriteToFile atomically writes data to filename by writing a temporary file in the same directory
+// and renaming it into place, so readers never see a partially written file.
+// Secret files are only readable by the owner. Existing files are only replaced if forced.
+func WriteToFile(data []byte, filename string, secret bool, opts WriteOptions) error {
+	if err := CheckWritable(filename, opts); err != nil {
+		logrus.WithField("outfile", filename).Error("file already exists")
+		return err
+	}
+
+	var mode os.FileMode = 0644
+	if secret {
+		mode = 0600
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		logrus.WithError(err).WithField("filename", filename).Error("Failed to create file")
+		return err
+	}
+	tmpName := tmpFile.Name()
+	defer os.Remove(tmpName)
+
+	if err := writeAndSync(tmpFile, data, mode); err != nil {
+		logrus.WithError(err).WithField("filename", filename).Error("Failed to write file")
+		return err
+	}
+
+	if _, err := os.Lstat(filename); err == nil && opts.Backup {
+		if err := backupFile(filename); err != nil {
+			return err
+		}
+	}
+
+	if opts.Force {
+		return os.Rename(tmpName, filename)
+	}
+	// Linking fails if the file has been created in the meantime, unlike rename which replaces it.
+	if err := os.Link(tmpName, filename); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("file %s already exists", filename)
+		}
+		if err := CheckWritable(filename, opts); err != nil {
+			return err
+		}
+		return os.Rename(tmpName, filename)
+	}
+	return nil
+}
+
+func writeAndSync(f *os.File, data []byte, mode os.FileMode) error {
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// backupFile copies the file to a new file with a timestamp suffix, keeping its permissions.
+func backupFile(filename string) error {
+	backupName := fmt.Sprintf("%s.%s.bak", filename, time.Now().UTC().Format("20060102T150405Z"))
+
+	src, err := os.Open(filename)
+	if err != nil {
+		logrus.WithError(err).WithField("filename", filename).Error("Failed to open file for backup")
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(backupName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		logrus.WithError(err).WithField("filename", backupName).Error("Failed to create backup file")
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	logrus.WithField("filename", backupName).Info("Created backup")
+	return dst.Close()
+}
+
+// FileSnapshot holds the previous contents of files which are about to be replaced.
+type FileSnapshot struct {
+	files []snapshotFile
+}
+
+type snapshotFile struct {
+	name   string
+	data   []byte
+	mode   os.FileMode
+	exists bool
+}
+
+// SnapshotFiles reads the current contents of the files. Files which do not exist yet are
+// removed again on restore.
+func SnapshotFiles(filenames ...string) (*FileSnapshot, error) {
+	snapshot := &FileSnapshot{}
+	for _, filename := range filenames {
+		file := snapshotFile{name: filename}
+		info, err := os.Stat(filename)
+		if err == nil {
+			if file.data, err = os.ReadFile(filename); err != nil {
+				logrus.WithError(err).WithField("filename", filename).Error("Failed to read file")
+				return nil, err
+			}
+			file.mode = info.Mode().Perm()
+			file.exists = true
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		snapshot.files = append(snapshot.files, file)
+	}
+	return snapshot, nil
+}
+
+// Restore atomically writes back the previous contents of all files, replacing the current ones.
+func (s *FileSnapshot) Restore() error {
+	var errs []error
+	for _, file := range s.files {
+		log := logrus.WithField("filename", file.name)
+		if !file.exists {
+			if err := os.Remove(file.name); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.WithError(err).Error("Failed to remove file")
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if err := ReplaceFile(file.data, file.name, file.mode); err != nil {
+			log.WithError(err).Error("Failed to restore file")
+			errs = append(errs, err)
+			continue
+		}
+		log.Info("Restored file")
+	}
+	return errors.Join(errs...)
+}
+
+// ReplaceFile atomically writes data to filename, replacing an existing file.
+// It is used for files owned by the client itself, like state files.
+func ReplaceFile(data []byte, filename string, mode os.FileMode) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmpFile.Name()
+	defer os.Remove(tmpName)
+
+	if err := writeAndSync(tmpFile, data, mode); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, filename)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"github.com/xcnt/drivr-certificate-client/api"
+	"github.com/xcnt/drivr-certificate-client/cert"
+)
+
+var (
+	agentCertificateFlag = &cli.StringSliceFlag{
+		Name:     certificateInfileFlag.Name,
+		Aliases:  certificateInfileFlag.Aliases,
+		Usage:    "Certificate file to renew. Can be given multiple times",
+		Required: true,
+		EnvVars:  []string{"DRIVR_AGENT_CERTIFICATES"},
+	}
+	renewBeforeFlag = &cli.DurationFlag{
+		Name:  "renew-before",
+		Usage: "Renew certificates this long before they expire, e.g. 720h. Takes precedence over --renew-fraction",
+	}
+	renewFractionFlag = &cli.Float64Flag{
+		Name:  "renew-fraction",
+		Value: 2.0 / 3.0,
+		Usage: "Renew certificates once this fraction of their lifetime has passed",
+	}
+	checkIntervalFlag = &cli.DurationFlag{
+		Name:  "check-interval",
+		Value: time.Hour,
+		Usage: "Interval in which the certificate files are checked",
+	}
+	retryMinFlag = &cli.DurationFlag{
+		Name:  "retry-min",
+		Value: 30 * time.Second,
+		Usage: "Delay before retrying a failed renewal. Doubled after every failure",
+	}
+	retryMaxFlag = &cli.DurationFlag{
+		Name:  "retry-max",
+		Value: time.Hour,
+		Usage: "Maximum delay before retrying a failed renewal",
+	}
+	onceFlag = &cli.BoolFlag{
+		Name:  "once",
+		Usage: "Check and renew the certificates once and exit",
+	}
+)
+
+func agentCommand() *cli.Command {
+	return withWaitFlags(&cli.Command{
+		Name:  "agent",
+		Usage: "Watch certificate files and renew them before they expire",
+		Description: "The agent renews the certificates with the details stored in their metadata files or looked up in DRIVR, " +
+			"see the renew command. SIGHUP triggers an immediate check of all certificates, SIGINT and SIGTERM stop the agent.",
+		Before: combinedCheckFuncs(checkAPIKey, checkAgentFlags),
+		Action: runAgent,
+		Flags: append([]cli.Flag{
+			agentCertificateFlag,
+			passphraseFileFlag,
+			pkcs11PINFileFlag,
+			rotateKeyFlag,
+			renewBeforeFlag,
+			renewFractionFlag,
+			checkIntervalFlag,
+			retryMinFlag,
+			retryMaxFlag,
+			onceFlag,
+			drivrAPIURLFlag,
+			backupFlag,
+		}, hookFlags...),
+	})
+}
+
+func checkAgentFlags(ctx *cli.Context) error {
+	if fraction := ctx.Float64(renewFractionFlag.Name); fraction <= 0 || fraction >= 1 {
+		return fmt.Errorf("%s must be between 0 and 1", renewFractionFlag.Name)
+	}
+	if ctx.Duration(renewBeforeFlag.Name) < 0 {
+		return fmt.Errorf("%s must not be negative", renewBeforeFlag.Name)
+	}
+	if ctx.Duration(checkIntervalFlag.Name) <= 0 || ctx.Duration(retryMinFlag.Name) <= 0 {
+		return fmt.Errorf("%s and %s must be positive", checkIntervalFlag.Name, retryMinFlag.Name)
+	}
+	if ctx.Duration(retryMaxFlag.Name) < ctx.Duration(retryMinFlag.Name) {
+		return fmt.Errorf("%s must not be less than %s", retryMaxFlag.Name, retryMinFlag.Name)
+	}
+	return nil
+}
+
+// renewalPolicy decides when certificates are renewed and how failed renewals are retried.
+type renewalPolicy struct {
+	Before        time.Duration
+	Fraction      float64
+	CheckInterval time.Duration
+	RetryMin      time.Duration
+	RetryMax      time.Duration
+}
+
+// renewalTime returns the time at which the certificate should be renewed.
+func (p renewalPolicy) renewalTime(certificate *x509.Certificate) time.Time {
+	if p.Before > 0 {
+		return certificate.NotAfter.Add(-p.Before)
+	}
+	lifetime := certificate.NotAfter.Sub(certificate.NotBefore)
+	return certificate.NotBefore.Add(time.Duration(float64(lifetime) * p.Fraction))
+}
+
+// nextCheck returns the renewal time or the next regular check of the certificate file, whichever comes first.
+func (p renewalPolicy) nextCheck(renewAt time.Time) time.Time {
+	if check := time.Now().Add(p.CheckInterval); check.Before(renewAt) {
+		return check
+	}
+	return renewAt
+}
+
+// retryDelay returns the exponential backoff with jitter after the given number of consecutive failures.
+func (p renewalPolicy) retryDelay(failures int) time.Duration {
+	delay := p.RetryMin
+	for i := 1; i < failures && delay < p.RetryMax; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.RetryMax)
+	return delay - time.Duration(rand.Int64N(int64(delay)/10+1))
+}
+
+// agentCertificate is the renewal state of a watched certificate file.
+type agentCertificate struct {
+	target   renewTarget
+	next     time.Time
+	failures int
+	lastErr  error
+}
+
+func runAgent(ctx *cli.Context) error {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	drivrAPI, err := drivrAPIFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+
+	policy := renewalPolicy{
+		Before:        ctx.Duration(renewBeforeFlag.Name),
+		Fraction:      ctx.Float64(renewFractionFlag.Name),
+		CheckInterval: ctx.Duration(checkIntervalFlag.Name),
+		RetryMin:      ctx.Duration(retryMinFlag.Name),
+		RetryMax:      ctx.Duration(retryMaxFlag.Name),
+	}
+
+	hooks, err := hookRunnerFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+
+	var certificates []*agentCertificate
+	for _, filename := range ctx.StringSlice(agentCertificateFlag.Name) {
+		certificates = append(certificates, &agentCertificate{
+			target: renewTarget{
+				CertificateFile: filename,
+				RotateKey:       ctx.Bool(rotateKeyFlag.Name),
+				Hooks:           hooks,
+				Wait:            waitOptionsFromFlags(ctx),
+				Write:           renewWriteOptions(ctx),
+			},
+		})
+	}
+
+	logrus.WithField("certificates", len(certificates)).Info("Starting renewal agent")
+	for {
+		next := checkCertificates(ctx, drivrAPI, policy, certificates)
+
+		if ctx.Bool(onceFlag.Name) {
+			for _, certificate := range certificates {
+				if certificate.lastErr != nil {
+					return errors.New("failed to renew all certificates")
+				}
+			}
+			return nil
+		}
+
+		logrus.WithField("next_check", next.Format(time.RFC3339)).Debug("Waiting for next check")
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			logrus.Info("Stopping renewal agent")
+			return nil
+		case <-hangup:
+			timer.Stop()
+			logrus.Info("Received SIGHUP, checking all certificates")
+			for _, certificate := range certificates {
+				certificate.next = time.Time{}
+				certificate.failures = 0
+			}
+		case <-timer.C:
+		}
+	}
+}
+
+// checkCertificates renews all due certificates and returns the time of the next check.
+func checkCertificates(ctx *cli.Context, drivrAPI *api.DrivrAPI, policy renewalPolicy, certificates []*agentCertificate) time.Time {
+	next := time.Now().Add(policy.CheckInterval)
+	for _, certificate := range certificates {
+		if ctx.Err() != nil {
+			break
+		}
+		if time.Now().After(certificate.next) {
+			checkCertificate(ctx, drivrAPI, policy, certificate)
+		}
+		if certificate.next.Before(next) {
+			next = certificate.next
+		}
+	}
+	return next
+}
+
+// checkCertificate renews the certificate if it is due and schedules its next check.
+func checkCertificate(ctx *cli.Context, drivrAPI *api.DrivrAPI, policy renewalPolicy, certificate *agentCertificate) {
+	log := logrus.WithField("filename", certificate.target.CertificateFile)
+
+	renewAt, err := certificateRenewalTime(policy, certificate.target.CertificateFile)
+	if err == nil && time.Now().Before(renewAt) {
+		log.WithField("renew_at", renewAt.Format(time.RFC3339)).Debug("Certificate is not due for renewal")
+		certificate.next = policy.nextCheck(renewAt)
+		certificate.failures = 0
+		certificate.lastErr = nil
+		return
+	}
+
+	if err == nil {
+		log.Info("Renewing certificate")
+		_, err = renewCertificateFile(ctx, drivrAPI, certificate.target)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		certificate.failures++
+		certificate.lastErr = err
+		delay := policy.retryDelay(certificate.failures)
+		log.WithError(err).WithField("retry_in", delay.Round(time.Second).String()).Error("Failed to renew certificate")
+		certificate.next = time.Now().Add(delay)
+		return
+	}
+
+	certificate.failures = 0
+	certificate.lastErr = nil
+	renewAt, err = certificateRenewalTime(policy, certificate.target.CertificateFile)
+	if err != nil {
+		log.WithError(err).Error("Failed to read renewed certificate")
+		certificate.next = time.Now().Add(policy.RetryMin)
+		return
+	}
+	log.WithField("renew_at", renewAt.Format(time.RFC3339)).Info("Certificate renewed")
+	if time.Now().After(renewAt) {
+		// a renewed certificate which is immediately due again must not renew in a tight loop
+		log.Warnf("Renewed certificate is already due for renewal, check --%s", renewBeforeFlag.Name)
+		renewAt = time.Now().Add(policy.RetryMax)
+	}
+	certificate.next = policy.nextCheck(renewAt)
+}
+
+// certificateRenewalTime reads the certificate file and returns the time at which it should be renewed.
+func certificateRenewalTime(policy renewalPolicy, filename string) (time.Time, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return time.Time{}, err
+	}
+	certificate, err := cert.ParseCertificate(data)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return policy.renewalTime(certificate), nil
+}
@@ -2,23 +2,26 @@ package main
 
 import (
 	"context"
+	"crypto"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/url"
 	"os"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 	"github.com/xcnt/drivr-certificate-client/api"
+	"github.com/xcnt/drivr-certificate-client/bundle"
 	"github.com/xcnt/drivr-certificate-client/cert"
 )
 
 const (
-	PRIVATE_KEY_FILE  = "private.key"
-	FETCH_DELAY_SEC   = 1
-	FETCH_TIMEOUT_SEC = 120
+	PRIVATE_KEY_FILE = "private.key"
 )
 
 var (
@@ -28,16 +31,26 @@ var (
 		Usage:   "Number of bits for the key",
 		Value:   2048,
 	}
+	keyAlgorithmFlag = &cli.StringFlag{
+		Name:  "key-algorithm",
+		Usage: "Algorithm of the generated key. One of rsa, ecdsa-p256, ecdsa-p384 or ed25519",
+		Value: string(cert.RSA),
+	}
+	keyFormatFlag = &cli.StringFlag{
+		Name:  "key-format",
+		Usage: "Encoding of the generated private key. Either traditional (PKCS#1 for RSA, SEC1 for ECDSA) or pkcs8",
+		Value: string(cert.Traditional),
+	}
 	privateKeyOutfileFlag = &cli.StringFlag{
 		Name:    "private-key-outfile",
 		Aliases: []string{"o"},
-		Usage:   "Output file for the generated private key",
+		Usage:   "Output file for the generated private key or tpm: URI of the persistent handle to create the key at",
 		Value:   PRIVATE_KEY_FILE,
 	}
 	privateKeyInfileFlag = &cli.StringFlag{
 		Name:    "private-key-infile",
 		Aliases: []string{"p"},
-		Usage:   "Input file containing private key to sign certificate request",
+		Usage:   "Input file containing private key to sign certificate request, pkcs11: URI of a token-held key or tpm: URI of a TPM-resident key",
 		Value:   PRIVATE_KEY_FILE,
 	}
 	publicKeyOutfileFlag = &cli.StringFlag{
@@ -56,6 +69,46 @@ var (
 		Aliases: []string{"sn"},
 		Usage:   "The server name for the certificate. If this is set a server certificate will be requested with the name as the common name. DRIVR only signs certificates which end in .local for local API authentication",
 	}
+	commonNameFlag = &cli.StringFlag{
+		Name:  "common-name",
+		Usage: "Common name (CN) of the certificate subject. Defaults to a random UUID",
+	}
+	organizationFlag = &cli.StringSliceFlag{
+		Name:  "organization",
+		Usage: "Organization (O) of the certificate subject. Can be passed multiple times",
+	}
+	organizationalUnitFlag = &cli.StringSliceFlag{
+		Name:  "organizational-unit",
+		Usage: "Organizational unit (OU) of the certificate subject. Can be passed multiple times",
+	}
+	countryFlag = &cli.StringSliceFlag{
+		Name:  "country",
+		Usage: "Country (C) of the certificate subject. Can be passed multiple times",
+	}
+	localityFlag = &cli.StringSliceFlag{
+		Name:  "locality",
+		Usage: "Locality (L) of the certificate subject. Can be passed multiple times",
+	}
+	subjectSerialNumberFlag = &cli.StringFlag{
+		Name:  "subject-serial-number",
+		Usage: "Serial number attribute of the certificate subject",
+	}
+	dnsNameFlag = &cli.StringSliceFlag{
+		Name:  "dns-name",
+		Usage: "Additional DNS Subject Alternative Name. Can be passed multiple times",
+	}
+	ipAddressFlag = &cli.StringSliceFlag{
+		Name:  "ip-address",
+		Usage: "IP address Subject Alternative Name. Can be passed multiple times",
+	}
+	uriFlag = &cli.StringSliceFlag{
+		Name:  "uri",
+		Usage: "URI Subject Alternative Name, e.g. a SPIFFE ID. Can be passed multiple times",
+	}
+	csrInfileFlag = &cli.StringFlag{
+		Name:  "csr-infile",
+		Usage: "Submit an externally generated certificate request instead of creating one from the private key",
+	}
 )
 
 func createCommand() *cli.Command {
@@ -63,8 +116,8 @@ func createCommand() *cli.Command {
 		Name:  "create",
 		Usage: "Create a new certificate",
 		Subcommands: []*cli.Command{
-			keyPairCommand(),
-			certificateCommand(),
+			withWriteFlags(keyPairCommand()),
+			withWaitFlags(withWriteFlags(certificateCommand())),
 		},
 	}
 }
@@ -75,9 +128,13 @@ func keyPairCommand() *cli.Command {
 		Usage:  "Create a new key pair",
 		Action: createKeyPair,
 		Flags: []cli.Flag{
+			keyAlgorithmFlag,
+			keyFormatFlag,
 			keyBitsFlag,
 			privateKeyOutfileFlag,
 			publicKeyOutfileFlag,
+			encryptKeyFlag,
+			passphraseFileFlag,
 		},
 	}
 }
@@ -90,18 +147,67 @@ func createKeyPair(ctx *cli.Context) error {
 		return fmt.Errorf("Private key and public key output file cannot be the same")
 	}
 
-	return cert.GenerateRSAKeyPair(ctx.Int(keyBitsFlag.Name), privateKeyOutfile, publicKeyOutfile)
+	keyAlgorithm, err := cert.ParseKeyAlgorithm(ctx.String(keyAlgorithmFlag.Name))
+	if err != nil {
+		return err
+	}
+
+	if publicKeyOutfile != "" {
+		publicKeyOutfile = outputPath(ctx, publicKeyOutfile)
+	}
+	if cert.IsTPMURI(privateKeyOutfile) {
+		return generateTPMKey(privateKeyOutfile, keyAlgorithm, ctx.Int(keyBitsFlag.Name), publicKeyOutfile, writeOptionsFromFlags(ctx))
+	}
+	privateKeyOutfile = outputPath(ctx, privateKeyOutfile)
+
+	keyFormat, err := cert.ParseKeyFormat(ctx.String(keyFormatFlag.Name))
+	if err != nil {
+		return err
+	}
+
+	keyOptions := cert.KeyOptions{
+		Algorithm: keyAlgorithm,
+		Format:    keyFormat,
+		Bits:      ctx.Int(keyBitsFlag.Name),
+	}
+	if ctx.Bool(encryptKeyFlag.Name) {
+		if keyOptions.Passphrase, err = getKeyPassphrase(ctx, true); err != nil {
+			return err
+		}
+	}
+
+	return cert.GenerateKeyPair(keyOptions, privateKeyOutfile, publicKeyOutfile, writeOptionsFromFlags(ctx))
+}
+
+func generateTPMKey(ref string, keyAlgorithm cert.KeyAlgorithm, bits int, publicKeyOutfile string, opts cert.WriteOptions) error {
+	logrus.WithField("key", ref).Info("Generating key in TPM")
+	privKey, keyCloser, err := cert.GenerateTPMKey(ref, keyAlgorithm, bits)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to generate TPM key")
+		return err
+	}
+	defer keyCloser.Close()
+
+	if publicKeyOutfile == "" {
+		return nil
+	}
+	return cert.DumpPublicKey(privKey, publicKeyOutfile, opts)
 }
 
 func certificateCommand() *cli.Command {
 	return &cli.Command{
 		Name:   "certificate",
 		Usage:  "Create a new certificate",
-		Before: combinedCheckFuncs(checkSystemComponentCode, checkAPIKey),
+		Before: combinedCheckFuncs(checkEntitySelection, checkAPIKey),
 		Action: createCertificate,
-		Flags: []cli.Flag{
+		Flags: slices.Concat([]cli.Flag{
 			nameFlag,
 			privateKeyInfileFlag,
+			keyAlgorithmFlag,
+			keyBitsFlag,
+			encryptKeyFlag,
+			passphraseFileFlag,
+			pkcs11PINFileFlag,
 			systemCodeFlag,
 			componentCodeFlag,
 			drivrAPIURLFlag,
@@ -109,11 +215,77 @@ func certificateCommand() *cli.Command {
 			issuerFlag,
 			certificateDurationFlag,
 			serverNameFlag,
-		},
+			commonNameFlag,
+			organizationFlag,
+			organizationalUnitFlag,
+			countryFlag,
+			localityFlag,
+			subjectSerialNumberFlag,
+			dnsNameFlag,
+			ipAddressFlag,
+			uriFlag,
+			csrInfileFlag,
+			writeMetadataFlag,
+			noWaitFlag,
+			journalDirFlag,
+		}, outputFlags, hookFlags, selectorFlags),
+	}
+}
+
+// csrFlags are the flags which only apply when the client creates the CSR itself.
+var csrFlags = []cli.Flag{
+	privateKeyInfileFlag,
+	keyAlgorithmFlag,
+	keyBitsFlag,
+	encryptKeyFlag,
+	commonNameFlag,
+	organizationFlag,
+	organizationalUnitFlag,
+	countryFlag,
+	localityFlag,
+	subjectSerialNumberFlag,
+	dnsNameFlag,
+	ipAddressFlag,
+	uriFlag,
+}
+
+// csrDataFromFlags collects the CSR subject and Subject Alternative Names from the command line.
+func csrDataFromFlags(ctx *cli.Context) (*cert.CSRData, error) {
+	csrData := &cert.CSRData{
+		CommonName:         ctx.String(commonNameFlag.Name),
+		Organization:       ctx.StringSlice(organizationFlag.Name),
+		OrganizationalUnit: ctx.StringSlice(organizationalUnitFlag.Name),
+		Country:            ctx.StringSlice(countryFlag.Name),
+		Locality:           ctx.StringSlice(localityFlag.Name),
+		SerialNumber:       ctx.String(subjectSerialNumberFlag.Name),
+		ServerName:         ctx.String(serverNameFlag.Name),
+		DNSNames:           ctx.StringSlice(dnsNameFlag.Name),
+	}
+
+	for _, address := range ctx.StringSlice(ipAddressFlag.Name) {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %s", address)
+		}
+		csrData.IPAddresses = append(csrData.IPAddresses, ip)
+	}
+
+	for _, rawURI := range ctx.StringSlice(uriFlag.Name) {
+		uri, err := url.Parse(rawURI)
+		if err != nil || uri.Scheme == "" {
+			return nil, fmt.Errorf("invalid URI %s", rawURI)
+		}
+		csrData.URIs = append(csrData.URIs, uri)
 	}
+
+	return csrData, nil
 }
 
 func createCertificate(ctx *cli.Context) error {
+	if ctx.String(selectFlag.Name) != "" {
+		return createSelectedCertificates(ctx)
+	}
+
 	name := ctx.String(nameFlag.Name)
 	systemCode := ctx.String(systemCodeFlag.Name)
 	componentCode := ctx.String(componentCodeFlag.Name)
@@ -122,15 +294,33 @@ func createCertificate(ctx *cli.Context) error {
 	serverName := ctx.String(serverNameFlag.Name)
 	addServerUse := len(serverName) > 0
 
-	certificateOutfile := ctx.String(certificateOutfileFlag.Name)
-	if certificateOutfile == "" {
-		certificateOutfile = fmt.Sprintf("%s.crt", name)
+	privateKeyFile := ctx.String(privateKeyInfileFlag.Name)
+	if ctx.String(csrInfileFlag.Name) != "" {
+		privateKeyFile = ""
 	}
 
-	var err error
+	outputFormat, err := outputFormatFromFlags(ctx, privateKeyFile)
+	if err != nil {
+		return err
+	}
 
-	if _, err := os.Stat(certificateOutfile); err == nil {
-		return fmt.Errorf("output file %s already exists", certificateOutfile)
+	certificateOutfile, err := certificateOutfileFromFlags(ctx, name, outputFormat)
+	if err != nil {
+		return err
+	}
+
+	hooks, err := hookRunnerFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+
+	noWait := ctx.Bool(noWaitFlag.Name)
+	if noWait && ctx.IsSet(hookFlag.Name) {
+		return fmt.Errorf("%s cannot be used with %s, the certificate is not written", noWaitFlag.Name, hookFlag.Name)
+	}
+
+	if err := cert.CheckWritable(certificateOutfile, writeOptionsFromFlags(ctx)); err != nil {
+		return err
 	}
 
 	apiURL, err := url.Parse(getAPIUrl(ctx))
@@ -139,122 +329,357 @@ func createCertificate(ctx *cli.Context) error {
 		return err
 	}
 
-	// load private key
-	privateKeyFile := ctx.String(privateKeyInfileFlag.Name)
+	var csr []byte
+	if csrInfile := ctx.String(csrInfileFlag.Name); csrInfile != "" {
+		csr, err = loadExternalCSR(ctx, csrInfile)
+	} else {
+		csr, err = createCSRFromFlags(ctx)
+	}
+	if err != nil {
+		return err
+	}
 
-	if _, err := os.Stat(privateKeyFile); os.IsNotExist(err) {
-		logrus.Info("Private key file does not exist - generating new key pair")
+	logrus.Debug("Initializing DRIVR API Client")
+	drivrAPI, err := api.NewDrivrAPI(apiURL, getAPIKey())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to create DRIVR API client")
+		return err
+	}
 
-		if err := cert.GenerateRSAKeyPair(keyBitsFlag.Value, privateKeyFile, ""); err != nil {
-			logrus.WithError(err).Error("Failed to generate key pair")
+	request := &certificateRequest{
+		Name:          name,
+		SystemCode:    systemCode,
+		ComponentCode: componentCode,
+		Issuer:        issuer,
+		Duration:      duration,
+		ServerUse:     addServerUse,
+		CSR:           csr,
+	}
+
+	journal := journalFromFlags(ctx)
+	var certificateUUID *uuid.UUID
+	entry := resumableJournalEntry(journal, certificateOutfile, request)
+	if entry != nil {
+		logrus.WithField("certificate_uuid", entry.CertificateUUID).Info("Resuming certificate request from journal")
+		certificateUUID = entry.CertificateUUID
+		request.EntityUUID = entry.EntityUUID
+		request.IssuerUUID = entry.IssuerUUID
+	} else {
+		entry = newJournalEntry(request, privateKeyFile, certificateOutfile, outputFormat, ctx.Bool(writeMetadataFlag.Name))
+		saveJournal(journal, entry)
+		certificateUUID, err = requestCertificate(ctx.Context, drivrAPI, request)
+		if err != nil {
+			if isPermanentRequestError(err) {
+				removeJournal(journal, entry)
+			}
 			return err
 		}
+		journalRequested(journal, entry, request, certificateUUID)
+	}
 
+	if noWait {
+		logrus.WithField("certificate_uuid", certificateUUID).Infof("Certificate requested, write it with 'pending finish %s'", entry.ID)
+		fmt.Println(certificateUUID)
+		return nil
 	}
 
-	logrus.WithField("filename", privateKeyFile).Debug("Loading private key")
-	privKey, err := cert.LoadPrivateKey(privateKeyFile)
+	certificate, _, err := waitForCertificate(ctx.Context, drivrAPI, certificateUUID, waitOptionsFromFlags(ctx))
 	if err != nil {
-		logrus.WithError(err).Error("Failed to load private key")
+		logrus.WithError(err).Errorf("Failed to fetch certificate, re-run the command or use 'pending finish %s' to resume", entry.ID)
 		return err
 	}
 
-	logrus.Debug("Initializing DRIVR API Client")
-	drivrAPI, err := api.NewDrivrAPI(apiURL, getAPIKey())
+	snapshot, err := hooks.snapshot(certificateOutfile, bundle.MetadataFilename(certificateOutfile))
 	if err != nil {
-		logrus.WithError(err).Error("Failed to create DRIVR API client")
 		return err
 	}
 
-	var entityUUID *uuid.UUID
-	if systemCode != "" {
-		entityUUID, err = drivrAPI.FetchSystemUUID(ctx.Context, systemCode)
+	if err := writeCertificateOutput(ctx, drivrAPI, outputFormat, certificateUUID, certificate, name, privateKeyFile, certificateOutfile, writeOptionsFromFlags(ctx)); err != nil {
+		return err
+	}
+
+	if ctx.Bool(writeMetadataFlag.Name) {
+		usages := []string{string(api.CertificateUsageClientAuth)}
+		if addServerUse {
+			usages = append(usages, string(api.CertificateUsageServerAuth))
+		}
+		err := bundle.WriteMetadata(&bundle.Metadata{
+			CertificateUUID: *certificateUUID,
+			Name:            name,
+			SystemCode:      systemCode,
+			ComponentCode:   componentCode,
+			Issuer:          issuer,
+			Duration:        duration,
+			Usages:          usages,
+			PrivateKey:      privateKeyFile,
+			IssuedAt:        time.Now().UTC(),
+		}, certificateOutfile, writeOptionsFromFlags(ctx))
 		if err != nil {
-			logrus.WithField("code", systemCode).WithError(err).Debug("Failed to fetch system")
 			return err
 		}
-	} else {
-		entityUUID, err = drivrAPI.FetchComponentUUID(ctx.Context, componentCode)
+	}
+	removeJournal(journal, entry)
+
+	return hooks.run(ctx.Context, hookEvent{
+		Event:           "create",
+		CertificateFile: certificateOutfile,
+		PrivateKeyFile:  privateKeyFile,
+		CertificateUUID: certificateUUID,
+		Name:            name,
+		EntityUUID:      request.EntityUUID,
+		SystemCode:      systemCode,
+		ComponentCode:   componentCode,
+		Certificate:     certificate,
+	}, snapshot)
+}
+
+// createCSRFromFlags creates a CSR signed by the private key given on the command line.
+// The private key is generated first if it does not exist.
+func createCSRFromFlags(ctx *cli.Context) ([]byte, error) {
+	csrData, err := csrDataFromFlags(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	privKey, keyCloser, err := openSignerFromFlags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer keyCloser.Close()
+
+	csr, err := cert.CreateCSR(privKey, csrData)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to generate CSR")
+		return nil, err
+	}
+	return csr, nil
+}
+
+// openSignerFromFlags opens the private key given on the command line.
+// The private key is generated first if it does not exist.
+func openSignerFromFlags(ctx *cli.Context) (crypto.Signer, io.Closer, error) {
+	privateKeyFile := ctx.String(privateKeyInfileFlag.Name)
+
+	if err := ensurePrivateKey(ctx, privateKeyFile); err != nil {
+		return nil, nil, err
+	}
+
+	logrus.WithField("filename", privateKeyFile).Debug("Loading private key")
+	privKey, keyCloser, err := cert.OpenSigner(privateKeyFile, keyPassphraseFunc(ctx), pkcs11PINFunc(ctx))
+	if err != nil {
+		logrus.WithError(err).Error("Failed to load private key")
+		return nil, nil, err
+	}
+	return privKey, keyCloser, nil
+}
+
+// loadExternalCSR loads and validates a CSR which was generated outside of the client.
+// The CSR is submitted unchanged, so flags which would alter it are rejected.
+func loadExternalCSR(ctx *cli.Context, csrInfile string) ([]byte, error) {
+	for _, flag := range csrFlags {
+		if ctx.IsSet(flag.Names()[0]) {
+			return nil, fmt.Errorf("--%s cannot be combined with --%s", flag.Names()[0], csrInfileFlag.Name)
+		}
+	}
+
+	logrus.WithField("filename", csrInfile).Debug("Loading certificate request")
+	csr, err := cert.LoadCSR(csrInfile)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cert.ValidateCSR(csr, ctx.String(serverNameFlag.Name)); err != nil {
+		logrus.WithError(err).WithField("filename", csrInfile).Error("Invalid certificate request")
+		return nil, err
+	}
+
+	return cert.EncodeCSR(csr), nil
+}
+
+// ensurePrivateKey generates the private key if the referenced key file or TPM handle does not exist yet.
+func ensurePrivateKey(ctx *cli.Context, privateKeyFile string) error {
+	keyAlgorithm, err := cert.ParseKeyAlgorithm(ctx.String(keyAlgorithmFlag.Name))
+	if err != nil {
+		return err
+	}
+
+	if cert.IsTPMURI(privateKeyFile) {
+		exists, err := cert.TPMKeyExists(privateKeyFile)
 		if err != nil {
-			logrus.WithField("code", componentCode).WithError(err).Debug("Failed to fetch component")
+			logrus.WithError(err).Error("Failed to look up TPM key")
 			return err
 		}
+		if exists {
+			return nil
+		}
+		return generateTPMKey(privateKeyFile, keyAlgorithm, ctx.Int(keyBitsFlag.Name), "", cert.WriteOptions{})
 	}
 
-	issuerUUID, err := drivrAPI.FetchIssuerUUID(ctx.Context, issuer)
-	if err != nil {
-		logrus.WithField("issuer", issuer).WithError(err).Debug("Failed to fetch issuer")
+	if !cert.IsFileKey(privateKeyFile) {
+		return nil
+	}
+	if _, err := os.Stat(privateKeyFile); !os.IsNotExist(err) {
+		return nil
+	}
+
+	logrus.Info("Private key file does not exist - generating new key pair")
+
+	keyOptions := cert.KeyOptions{
+		Algorithm: keyAlgorithm,
+		Format:    cert.Traditional,
+		Bits:      ctx.Int(keyBitsFlag.Name),
+	}
+	if ctx.Bool(encryptKeyFlag.Name) {
+		if keyOptions.Passphrase, err = getKeyPassphrase(ctx, true); err != nil {
+			return err
+		}
+	}
+
+	if err := cert.GenerateKeyPair(keyOptions, privateKeyFile, "", cert.WriteOptions{}); err != nil {
+		logrus.WithError(err).Error("Failed to generate key pair")
 		return err
 	}
+	return nil
+}
+
+// certificateRequest describes a certificate to be issued by DRIVR.
+type certificateRequest struct {
+	Name          string
+	SystemCode    string
+	ComponentCode string
+	// EntityUUID is used instead of looking up the system or component code if set.
+	// It is set to the resolved entity by issueCertificate.
+	EntityUUID *uuid.UUID
+	Issuer     string
+	// IssuerUUID is used instead of looking up the issuer by name if set.
+	// It is set to the resolved issuer by issueCertificate.
+	IssuerUUID *uuid.UUID
+	Duration   string
+	ServerUse  bool
+	CSR        []byte
+}
+
+// issueCertificate resolves the entity and issuer of the request, requests the certificate from DRIVR
+// and waits until it is signed.
+func issueCertificate(ctx context.Context, drivrAPI *api.DrivrAPI, request *certificateRequest, wait waitOptions) ([]byte, *uuid.UUID, error) {
+	certificateUUID, err := requestCertificate(ctx, drivrAPI, request)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	if entityUUID == nil {
-		return errors.New("entity UUID is nil")
+	certificate, _, err := waitForCertificate(ctx, drivrAPI, certificateUUID, wait)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to fetch certificate")
+		return nil, nil, err
 	}
 
+	return certificate, certificateUUID, nil
+}
+
+// requestCertificate resolves the entity and issuer of the request and requests the certificate from DRIVR.
+func requestCertificate(ctx context.Context, drivrAPI *api.DrivrAPI, request *certificateRequest) (*uuid.UUID, error) {
+	entityUUID := request.EntityUUID
+	var err error
+	if entityUUID != nil {
+		logrus.WithField("entity_uuid", entityUUID).Debug("Using known entity")
+	} else if request.SystemCode != "" {
+		entityUUID, err = drivrAPI.FetchSystemUUID(ctx, request.SystemCode)
+		if err != nil {
+			logrus.WithField("code", request.SystemCode).WithError(err).Debug("Failed to fetch system")
+			return nil, err
+		}
+	} else {
+		entityUUID, err = drivrAPI.FetchComponentUUID(ctx, request.ComponentCode)
+		if err != nil {
+			logrus.WithField("code", request.ComponentCode).WithError(err).Debug("Failed to fetch component")
+			return nil, err
+		}
+	}
+
+	issuerUUID := request.IssuerUUID
 	if issuerUUID == nil {
-		return errors.New("issuer UUID is nil")
+		issuerUUID, err = drivrAPI.FetchIssuerUUID(ctx, request.Issuer)
+		if err != nil {
+			logrus.WithField("issuer", request.Issuer).WithError(err).Debug("Failed to fetch issuer")
+			return nil, err
+		}
 	}
 
-	csr, err := cert.CreateCSR(privKey, &cert.CSRData{ServerName: serverName})
-	if err != nil {
-		logrus.WithError(err).Error("Failed to generate CSR")
-		return err
+	if entityUUID == nil {
+		return nil, errors.New("entity UUID is nil")
 	}
 
-	var certificateUUID *uuid.UUID
+	if issuerUUID == nil {
+		return nil, errors.New("issuer UUID is nil")
+	}
+	request.EntityUUID = entityUUID
+	request.IssuerUUID = issuerUUID
+
 	certificateInput := api.CreateCertificateInput{
-		Name:         name,
-		CSR:          string(csr),
-		Duration:     duration,
+		Name:         request.Name,
+		CSR:          string(request.CSR),
+		Duration:     request.Duration,
 		EntityUUID:   *entityUUID,
 		IssuerUUID:   *issuerUUID,
-		AddServerUse: addServerUse,
+		AddServerUse: request.ServerUse,
 	}
 
-	logrus.WithFields(certificateInput.LogFields()).Debug("Calling DRIVR API")
+	certificateUUID, err := findRequestedCertificate(ctx, drivrAPI, request)
+	if err != nil {
+		return nil, err
+	}
+	if certificateUUID != nil {
+		logrus.WithField("certificate_uuid", certificateUUID.String()).Info("Certificate has already been requested, resuming")
+		return certificateUUID, nil
+	}
 
-	certificateUUID, err = drivrAPI.CreateCertificate(ctx.Context, certificateInput)
+	logrus.WithFields(certificateInput.LogFields()).Debug("Calling DRIVR API")
 
+	certificateUUID, err = drivrAPI.CreateCertificate(ctx, certificateInput)
+	if errors.Is(err, api.ErrTransport) && ctx.Err() == nil {
+		// the response may have been lost after DRIVR created the certificate
+		if found, findErr := findRequestedCertificate(ctx, drivrAPI, request); findErr == nil && found != nil {
+			logrus.WithError(err).WithField("certificate_uuid", found.String()).Info("Certificate has been requested despite the error, resuming")
+			return found, nil
+		}
+	}
 	if err != nil {
 		logrus.WithError(err).Error("Failed to request certificate creation")
-		return err
+		return nil, err
 	}
 	logrus.WithField("certificate_uuid", certificateUUID.String()).Debug("Certificate requested")
 
-	certificate, _, err := waitForCertificate(ctx.Context, drivrAPI, certificateUUID)
+	return certificateUUID, nil
+}
+
+// findRequestedCertificate returns the certificate which has already been requested with the name of the request
+// for its entity and the public key of its CSR, e.g. by a run whose response got lost. It fails if the name is
+// taken by a certificate with another key and returns nil if no certificate has been requested yet.
+func findRequestedCertificate(ctx context.Context, drivrAPI *api.DrivrAPI, request *certificateRequest) (*uuid.UUID, error) {
+	csr, err := cert.ParseCSR(request.CSR)
 	if err != nil {
-		logrus.WithError(err).Error("Failed to fetch certificate")
-		return err
+		logrus.WithError(err).Error("Failed to parse certificate request")
+		return nil, err
 	}
 
-	logrus.Debugf("Writing certificate to %s", certificateOutfile)
-	return cert.WriteToPEMFile(cert.Certificate, certificate, certificateOutfile)
-}
-
-func waitForCertificate(ctx context.Context, api *api.DrivrAPI, certificateUUID *uuid.UUID) (certificate []byte, name string, err error) {
-	timeoutCtx, cancel := context.WithTimeout(ctx, FETCH_TIMEOUT_SEC*time.Second)
-	defer cancel()
-	certReady := make(chan interface{}, 1)
-
-	go func() {
-		for {
-			certificate, name, err = api.FetchCertificate(timeoutCtx, certificateUUID)
-			if err != nil {
-				logrus.WithError(err).Debug("Failed to fetch certificate")
-				time.Sleep(FETCH_DELAY_SEC * time.Second)
-				continue
-			}
+	certificates, err := drivrAPI.FindCertificatesByName(ctx, request.Name, *request.EntityUUID)
+	if err != nil {
+		return nil, err
+	}
 
-			certReady <- nil
-			return
+	for _, requested := range certificates {
+		requestedCSR, err := cert.ParseCSR([]byte(requested.CSR))
+		if err != nil {
+			logrus.WithError(err).WithField("certificate_uuid", requested.UUID).Debug("Failed to parse certificate request of existing certificate")
+			continue
+		}
+		if cert.PublicKeysEqual(requestedCSR.PublicKey, csr.PublicKey) {
+			return &requested.UUID, nil
 		}
-	}()
-
-	select {
-	case <-certReady:
-	case <-timeoutCtx.Done():
-		err = errors.New("timed out waiting for certificate")
 	}
 
-	return certificate, name, err
+	if len(certificates) > 0 {
+		return nil, fmt.Errorf("%w: certificate %s already exists for the entity with another key", api.ErrValidation, request.Name)
+	}
+	return nil, nil
 }
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"github.com/xcnt/drivr-certificate-client/api"
+	"github.com/xcnt/drivr-certificate-client/bundle"
+	"github.com/xcnt/drivr-certificate-client/cert"
+)
+
+const (
+	selectSystems    = "system"
+	selectComponents = "component"
+
+	// nameCodePlaceholder is replaced with the code of the selected entity in the certificate name.
+	nameCodePlaceholder = "{code}"
+)
+
+var (
+	selectFlag = &cli.StringFlag{
+		Name:  "select",
+		Usage: "Issue a certificate for every system or component matching the selector flags: system or component",
+	}
+	codePatternFlag = &cli.StringFlag{
+		Name:  "code-pattern",
+		Usage: "Select entities whose code matches the pattern. % or * match any characters, _ a single character",
+	}
+	metadataKeyFlag = &cli.StringFlag{
+		Name:  "metadata-key",
+		Usage: "Select entities which have the metadata key",
+	}
+	locationFlag = &cli.StringFlag{
+		Name:  "location",
+		Usage: "Select systems at the location with this UUID, or the components of these systems",
+	}
+	inSystemFlag = &cli.StringFlag{
+		Name:  "in-system",
+		Usage: "Select the components of the system with this code",
+	}
+	dryRunFlag = &cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Only list the selected entities and certificate names",
+	}
+
+	selectorFlags = []cli.Flag{selectFlag, codePatternFlag, metadataKeyFlag, locationFlag, inSystemFlag, dryRunFlag, stateFileFlag, concurrencyFlag}
+
+	// unselectableFlags only apply to a single certificate. Every selected entity gets its own key and certificate file.
+	unselectableFlags = []cli.Flag{
+		systemCodeFlag,
+		componentCodeFlag,
+		csrInfileFlag,
+		certificateOutfileFlag,
+		privateKeyInfileFlag,
+		organizationFlag,
+		organizationalUnitFlag,
+		countryFlag,
+		localityFlag,
+		subjectSerialNumberFlag,
+		uriFlag,
+		hookFlag,
+		noWaitFlag,
+	}
+)
+
+// checkEntitySelection checks either the selector flags or the system and component code.
+func checkEntitySelection(ctx *cli.Context) error {
+	switch ctx.String(selectFlag.Name) {
+	case "":
+		for _, flag := range []cli.Flag{codePatternFlag, metadataKeyFlag, locationFlag, inSystemFlag, dryRunFlag, stateFileFlag} {
+			if ctx.IsSet(flag.Names()[0]) {
+				return fmt.Errorf("%s requires --%s", flag.Names()[0], selectFlag.Name)
+			}
+		}
+		return checkSystemComponentCode(ctx)
+	case selectSystems:
+		if ctx.IsSet(inSystemFlag.Name) {
+			return fmt.Errorf("%s can only be used to select components", inSystemFlag.Name)
+		}
+	case selectComponents:
+	default:
+		return fmt.Errorf("invalid %s %s, must be system or component", selectFlag.Name, ctx.String(selectFlag.Name))
+	}
+
+	for _, flag := range unselectableFlags {
+		if ctx.IsSet(flag.Names()[0]) {
+			return fmt.Errorf("%s cannot be used with --%s", flag.Names()[0], selectFlag.Name)
+		}
+	}
+	if format, err := cert.ParseOutputFormat(ctx.String(outputFormatFlag.Name)); err != nil || format != cert.Leaf {
+		return fmt.Errorf("--%s only supports the %s output format", selectFlag.Name, cert.Leaf)
+	}
+	return nil
+}
+
+// entityFilterFromFlags builds the DRIVR filter of the selector flags. All given conditions have to match.
+func entityFilterFromFlags(ctx *cli.Context) (api.EntityFilter, error) {
+	components := ctx.String(selectFlag.Name) == selectComponents
+
+	var conditions []api.EntityFilter
+	if pattern := ctx.String(codePatternFlag.Name); pattern != "" {
+		conditions = append(conditions, api.EntityFilter{
+			"code": map[string]any{"_like": strings.ReplaceAll(pattern, "*", "%")},
+		})
+	}
+	if key := ctx.String(metadataKeyFlag.Name); key != "" {
+		conditions = append(conditions, api.EntityFilter{
+			"metadataKeyValueStore": map[string]any{"key": map[string]any{"_eq": key}},
+		})
+	}
+	if location := ctx.String(locationFlag.Name); location != "" {
+		locationUUID, err := uuid.Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid location UUID %s", location)
+		}
+		condition := api.EntityFilter{"locationUuid": map[string]any{"_eq": locationUUID}}
+		if components {
+			condition = api.EntityFilter{"system": condition}
+		}
+		conditions = append(conditions, condition)
+	}
+	if systemCode := ctx.String(inSystemFlag.Name); systemCode != "" {
+		conditions = append(conditions, api.EntityFilter{
+			"system": map[string]any{"code": map[string]any{"_eq": systemCode}},
+		})
+	}
+
+	switch len(conditions) {
+	case 0:
+		return nil, fmt.Errorf("--%s requires at least one of %s, %s, %s or %s", selectFlag.Name,
+			codePatternFlag.Name, metadataKeyFlag.Name, locationFlag.Name, inSystemFlag.Name)
+	case 1:
+		return conditions[0], nil
+	default:
+		return api.EntityFilter{"_and": conditions}, nil
+	}
+}
+
+// selectedCertificateName returns the certificate name for a selected entity. The code replaces the
+// {code} placeholder of the name or is appended to it.
+func selectedCertificateName(name string, entity api.Entity) string {
+	if strings.Contains(name, nameCodePlaceholder) {
+		return strings.ReplaceAll(name, nameCodePlaceholder, entity.Code)
+	}
+	return name + "-" + entity.Code
+}
+
+// selectStateFile returns the state file of a selection, defaulting to the certificate name without the
+// {code} placeholder in the output directory.
+func selectStateFile(ctx *cli.Context) string {
+	if stateFile := ctx.String(stateFileFlag.Name); stateFile != "" {
+		return stateFile
+	}
+	name := strings.Trim(strings.ReplaceAll(ctx.String(nameFlag.Name), nameCodePlaceholder, ""), "-_.")
+	if !isPlainFileName(name) {
+		name = selectFlag.Name
+	}
+	return outputPath(ctx, name+".state.json")
+}
+
+// createSelectedCertificates issues a certificate for every system or component matching the selector flags.
+func createSelectedCertificates(ctx *cli.Context) error {
+	where, err := entityFilterFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+
+	drivrAPI, err := drivrAPIFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+
+	var entities []api.Entity
+	if ctx.String(selectFlag.Name) == selectComponents {
+		entities, err = drivrAPI.SelectComponents(ctx.Context, where)
+	} else {
+		entities, err = drivrAPI.SelectSystems(ctx.Context, where)
+	}
+	if err != nil {
+		return err
+	}
+	if len(entities) == 0 {
+		return errors.New("no entities match the selection")
+	}
+
+	entries := make([]bundle.ManifestEntry, 0, len(entities))
+	for _, entity := range entities {
+		entry := bundle.ManifestEntry{
+			Name:        selectedCertificateName(ctx.String(nameFlag.Name), entity),
+			EntityUUID:  &entity.UUID,
+			Issuer:      ctx.String(issuerFlag.Name),
+			Duration:    ctx.String(certificateDurationFlag.Name),
+			ServerName:  ctx.String(serverNameFlag.Name),
+			CommonName:  ctx.String(commonNameFlag.Name),
+			DNSNames:    ctx.StringSlice(dnsNameFlag.Name),
+			IPAddresses: ctx.StringSlice(ipAddressFlag.Name),
+		}
+		if ctx.String(selectFlag.Name) == selectComponents {
+			entry.ComponentCode = entity.Code
+		} else {
+			entry.SystemCode = entity.Code
+		}
+		if !isPlainFileName(entry.Name) {
+			return fmt.Errorf("certificate name %s of %s must not contain a path", entry.Name, entity.Code)
+		}
+		entries = append(entries, entry)
+	}
+
+	if ctx.Bool(dryRunFlag.Name) {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CODE\tNAME\tUUID\tCERTIFICATE")
+		for i, entity := range entities {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entity.Code, entity.Name, entity.UUID, entries[i].Name)
+		}
+		return w.Flush()
+	}
+
+	stateFile := selectStateFile(ctx)
+	state, err := bundle.LoadProvisionState(stateFile)
+	if err != nil {
+		logrus.WithError(err).WithField("filename", stateFile).Error("Failed to load state file")
+		return err
+	}
+
+	logrus.WithField("entities", len(entities)).WithField("state_file", stateFile).Info("Issuing certificates for selected entities")
+	results, err := provisionEntries(ctx, drivrAPI, entries, state, stateFile)
+	if err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		logrus.Warn("Issuing certificates interrupted, run the command again to resume")
+	}
+	printProvisionSummary(results)
+	return provisionError(results)
+}
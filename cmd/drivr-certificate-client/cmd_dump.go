@@ -20,20 +20,23 @@ var (
 )
 
 func dumpCommand() *cli.Command {
-	return &cli.Command{
+	return withWriteFlags(&cli.Command{
 		Name:  "dump",
 		Usage: "dump public key",
 		Flags: []cli.Flag{
 			dumpPubKeyOutfileFlag,
 			privateKeyInfileFlag,
+			passphraseFileFlag,
+			pkcs11PINFileFlag,
 		},
 		Action: func(c *cli.Context) error {
-			privKey, err := cert.LoadPrivateKey(c.String(privateKeyInfileFlag.Name))
+			privKey, keyCloser, err := cert.OpenSigner(c.String(privateKeyInfileFlag.Name), keyPassphraseFunc(c), pkcs11PINFunc(c))
 			if err != nil {
 				logrus.WithError(err).Error("failed to load private key")
 				return err
 			}
-			return cert.DumpPublicKey(privKey, c.String(dumpPubKeyOutfileFlag.Name))
+			defer keyCloser.Close()
+			return cert.DumpPublicKey(privKey, outputPath(c, c.String(dumpPubKeyOutfileFlag.Name)), writeOptionsFromFlags(c))
 		},
-	}
+	})
 }
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"github.com/xcnt/drivr-certificate-client/api"
+	"github.com/xcnt/drivr-certificate-client/cert"
+)
+
+var (
+	exportCertificateUUIDFlag = &cli.StringFlag{
+		Name:  certificateUUIDFlag.Name,
+		Usage: "UUID of the certificate to fetch from DRIVR instead of reading the certificate file",
+	}
+	exportNameFlag = &cli.StringFlag{
+		Name:    nameFlag.Name,
+		Aliases: nameFlag.Aliases,
+		Usage:   "Friendly name of the exported entries. Defaults to the DRIVR certificate name or the common name of the certificate",
+	}
+	exportOutfileFlag = &cli.StringFlag{
+		Name:    "outfile",
+		Aliases: []string{"o"},
+		Usage:   "Output file. Defaults to the friendly name with the extension of the format",
+	}
+	jksAliasFlag = &cli.StringFlag{
+		Name:  "alias",
+		Usage: "Alias of the private key entry in the keystore. Defaults to the friendly name",
+	}
+	jksCAAliasFlag = &cli.StringFlag{
+		Name:  "ca-alias",
+		Usage: "Alias of the CA certificate in the truststore. Defaults to the keystore alias with a -ca suffix",
+	}
+	jksKeyPasswordFileFlag = &cli.StringFlag{
+		Name:  "key-password-file",
+		Usage: "File containing the password of the private key entry. Defaults to the keystore password",
+	}
+	truststoreOutfileFlag = &cli.StringFlag{
+		Name:  "truststore-outfile",
+		Usage: "Truststore output file. Defaults to the friendly name with the extension truststore.jks",
+	}
+	truststorePasswordFileFlag = &cli.StringFlag{
+		Name:  "truststore-password-file",
+		Usage: "File containing the password of the truststore. Defaults to the keystore password",
+	}
+)
+
+func exportCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "export",
+		Usage: "Export a private key and its certificate to a key store",
+		Subcommands: []*cli.Command{
+			withWriteFlags(exportPKCS12Command()),
+			withWriteFlags(exportJKSCommand()),
+		},
+	}
+}
+
+func exportFlags(flags ...cli.Flag) []cli.Flag {
+	return append([]cli.Flag{
+		certificateInfileFlag,
+		exportCertificateUUIDFlag,
+		privateKeyInfileFlag,
+		passphraseFileFlag,
+		verifyCACertFlag,
+		issuerFlag,
+		optionalDrivrAPIURLFlag,
+		exportNameFlag,
+		exportOutfileFlag,
+	}, flags...)
+}
+
+func exportPKCS12Command() *cli.Command {
+	return &cli.Command{
+		Name:   "pkcs12",
+		Usage:  "Export the private key, certificate and issuer CA as password protected PKCS#12 file",
+		Action: exportPKCS12,
+		Flags:  exportFlags(exportPasswordFileFlag),
+	}
+}
+
+func exportJKSCommand() *cli.Command {
+	return &cli.Command{
+		Name:   "jks",
+		Usage:  "Export the private key and certificate as Java keystore and the issuer CA as Java truststore",
+		Action: exportJKS,
+		Flags: exportFlags(
+			exportPasswordFileFlag,
+			jksAliasFlag,
+			jksKeyPasswordFileFlag,
+			truststoreOutfileFlag,
+			jksCAAliasFlag,
+			truststorePasswordFileFlag,
+		),
+	}
+}
+
+// exportMaterial is the content of an exported key store.
+type exportMaterial struct {
+	name           string
+	privateKey     crypto.Signer
+	certificate    *x509.Certificate
+	caCertificates []*x509.Certificate
+}
+
+// loadExportMaterial reads the private key, the certificate either from file or DRIVR and the issuer CA.
+func loadExportMaterial(ctx *cli.Context) (*exportMaterial, error) {
+	material := &exportMaterial{name: ctx.String(exportNameFlag.Name)}
+
+	certificateFile := ctx.String(certificateInfileFlag.Name)
+	certificateUUIDstr := ctx.String(exportCertificateUUIDFlag.Name)
+	switch {
+	case certificateFile != "" && certificateUUIDstr != "":
+		return nil, fmt.Errorf("either %s or %s must be specified, not both", certificateInfileFlag.Name, exportCertificateUUIDFlag.Name)
+	case certificateFile != "":
+		certificate, err := cert.LoadCertificate(certificateFile)
+		if err != nil {
+			logrus.WithError(err).WithField("filename", certificateFile).Error("Failed to load certificate")
+			return nil, err
+		}
+		material.certificate = certificate
+	case certificateUUIDstr != "":
+		certificateUUID, err := uuid.Parse(certificateUUIDstr)
+		if err != nil {
+			logrus.WithField("certificate_uuid", certificateUUIDstr).Error("Invalid certificate UUID")
+			return nil, errors.New("invalid certificate UUID")
+		}
+		certificate, name, err := fetchCertificateFromFlags(ctx, &certificateUUID)
+		if err != nil {
+			return nil, err
+		}
+		material.certificate = certificate
+		if material.name == "" {
+			material.name = name
+		}
+	default:
+		return nil, fmt.Errorf("either %s or %s must be specified", certificateInfileFlag.Name, exportCertificateUUIDFlag.Name)
+	}
+
+	if material.name == "" {
+		material.name = material.certificate.Subject.CommonName
+	}
+
+	privateKeyFile := ctx.String(privateKeyInfileFlag.Name)
+	if !cert.IsFileKey(privateKeyFile) {
+		return nil, fmt.Errorf("private key %s is not exportable", privateKeyFile)
+	}
+	privateKey, err := cert.LoadPrivateKey(privateKeyFile, keyPassphraseFunc(ctx))
+	if err != nil {
+		logrus.WithError(err).WithField("filename", privateKeyFile).Error("Failed to load private key")
+		return nil, err
+	}
+	if !cert.PublicKeysEqual(privateKey.Public(), material.certificate.PublicKey) {
+		return nil, errors.New("private key does not match the certificate")
+	}
+	material.privateKey = privateKey
+
+	caCertificates, err := loadCACertificates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, caCertificate := range caCertificates {
+		if err := material.certificate.CheckSignatureFrom(caCertificate); err == nil {
+			material.caCertificates = append(material.caCertificates, caCertificate)
+		}
+	}
+	if len(material.caCertificates) == 0 {
+		logrus.Warn("Certificate is not signed by the given CA, exporting all CA certificates")
+		material.caCertificates = caCertificates
+	}
+
+	return material, nil
+}
+
+// fetchCertificateFromFlags fetches a signed certificate and its name from DRIVR.
+func fetchCertificateFromFlags(ctx *cli.Context, certificateUUID *uuid.UUID) (*x509.Certificate, string, error) {
+	if ctx.String(optionalDrivrAPIURLFlag.Name) == "" {
+		return nil, "", fmt.Errorf("%s must be specified to fetch the certificate", optionalDrivrAPIURLFlag.Name)
+	}
+	if err := checkAPIKey(ctx); err != nil {
+		return nil, "", err
+	}
+	apiURL, err := url.Parse(getAPIUrl(ctx))
+	if err != nil {
+		logrus.WithError(err).Error("Failed to parse GraphQL API URL")
+		return nil, "", err
+	}
+	drivrAPI, err := api.NewDrivrAPI(apiURL, getAPIKey())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to initialize DRIVR API Client")
+		return nil, "", err
+	}
+
+	certificateBytes, name, err := drivrAPI.FetchCertificate(ctx.Context, certificateUUID)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to fetch certificate")
+		return nil, "", err
+	}
+	certificate, err := x509.ParseCertificate(certificateBytes)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to parse certificate")
+		return nil, "", err
+	}
+	return certificate, name, nil
+}
+
+// exportOutfile returns the output file, defaulting to the friendly name with the given extension.
+func exportOutfile(ctx *cli.Context, name, extension string) (string, error) {
+	if outfile := ctx.String(exportOutfileFlag.Name); outfile != "" {
+		return outputPath(ctx, outfile), nil
+	}
+	return defaultOutfile(ctx, name, extension)
+}
+
+// exportTruststoreOutfile returns the truststore output file, defaulting to the friendly name with the extension truststore.jks.
+func exportTruststoreOutfile(ctx *cli.Context, name string) (string, error) {
+	if outfile := ctx.String(truststoreOutfileFlag.Name); outfile != "" {
+		return outputPath(ctx, outfile), nil
+	}
+	return defaultOutfile(ctx, name, "truststore.jks")
+}
+
+func exportPKCS12(ctx *cli.Context) error {
+	material, err := loadExportMaterial(ctx)
+	if err != nil {
+		return err
+	}
+
+	password, err := getExportPassword(ctx)
+	if err != nil {
+		return err
+	}
+
+	entry := cert.PKCS12Entry{
+		FriendlyName: material.name,
+		PrivateKey:   material.privateKey,
+		Certificate:  material.certificate.Raw,
+	}
+	for _, caCertificate := range material.caCertificates {
+		entry.CACertificates = append(entry.CACertificates, caCertificate.Raw)
+	}
+
+	data, err := cert.EncodePKCS12(entry, password)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to encode PKCS#12 file")
+		return err
+	}
+
+	outfile, err := exportOutfile(ctx, material.name, cert.PKCS12.Extension())
+	if err != nil {
+		return err
+	}
+	logrus.Debugf("Writing PKCS#12 file to %s", outfile)
+	if err := cert.WriteToFile(data, outfile, true, writeOptionsFromFlags(ctx)); err != nil {
+		logrus.WithError(err).WithField("filename", outfile).Error("Failed to write PKCS#12 file")
+		return err
+	}
+	return nil
+}
+
+func exportJKS(ctx *cli.Context) error {
+	material, err := loadExportMaterial(ctx)
+	if err != nil {
+		return err
+	}
+
+	storePassword, err := getExportPassword(ctx)
+	if err != nil {
+		return err
+	}
+	keyPassword, err := readOptionalPasswordFile(ctx.String(jksKeyPasswordFileFlag.Name), "key password", storePassword)
+	if err != nil {
+		return err
+	}
+	truststorePassword, err := readOptionalPasswordFile(ctx.String(truststorePasswordFileFlag.Name), "truststore password", storePassword)
+	if err != nil {
+		return err
+	}
+
+	alias := ctx.String(jksAliasFlag.Name)
+	if alias == "" {
+		alias = material.name
+	}
+	caAlias := ctx.String(jksCAAliasFlag.Name)
+	if caAlias == "" {
+		caAlias = alias + "-ca"
+	}
+
+	entry := cert.JKSKeyEntry{
+		Alias:            alias,
+		PrivateKey:       material.privateKey,
+		CertificateChain: [][]byte{material.certificate.Raw},
+		Password:         keyPassword,
+	}
+	var caCertificates [][]byte
+	for _, caCertificate := range material.caCertificates {
+		entry.CertificateChain = append(entry.CertificateChain, caCertificate.Raw)
+		caCertificates = append(caCertificates, caCertificate.Raw)
+	}
+
+	keystore, err := cert.EncodeJKSKeyStore(entry, storePassword)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to encode keystore")
+		return err
+	}
+	truststore, err := cert.EncodeJKSTrustStore(caAlias, caCertificates, truststorePassword)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to encode truststore")
+		return err
+	}
+
+	// both files are checked first, so an existing truststore does not leave a keystore without it
+	outfile, err := exportOutfile(ctx, material.name, "jks")
+	if err != nil {
+		return err
+	}
+	truststoreOutfile, err := exportTruststoreOutfile(ctx, material.name)
+	if err != nil {
+		return err
+	}
+	if outfile == truststoreOutfile {
+		return fmt.Errorf("keystore and truststore must be written to different files")
+	}
+	writeOptions := writeOptionsFromFlags(ctx)
+	for _, filename := range []string{outfile, truststoreOutfile} {
+		if err := cert.CheckWritable(filename, writeOptions); err != nil {
+			logrus.WithField("outfile", filename).Error("file already exists")
+			return err
+		}
+	}
+
+	logrus.Debugf("Writing keystore to %s", outfile)
+	if err := cert.WriteToFile(keystore, outfile, true, writeOptions); err != nil {
+		logrus.WithError(err).WithField("filename", outfile).Error("Failed to write keystore")
+		return err
+	}
+
+	logrus.Debugf("Writing truststore to %s", truststoreOutfile)
+	if err := cert.WriteToFile(truststore, truststoreOutfile, false, writeOptions); err != nil {
+		logrus.WithError(err).WithField("filename", truststoreOutfile).Error("Failed to write truststore")
+		return err
+	}
+	return nil
+}
+
+// readOptionalPasswordFile reads a password from the file or returns the fallback if no file is given.
+func readOptionalPasswordFile(filename, description string, fallback []byte) ([]byte, error) {
+	if filename == "" {
+		return fallback, nil
+	}
+	return readSecret(filename, "", description, false)
+}
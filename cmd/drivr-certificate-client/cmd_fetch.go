@@ -3,8 +3,8 @@ package main
 import (
 	"context"
 	"errors"
-	"fmt"
 	"net/url"
+	"slices"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
@@ -19,6 +19,11 @@ var (
 		Usage:    "Certificate UUID",
 		Required: true,
 	}
+	caOutfileFlag = &cli.StringFlag{
+		Name:  "ca-outfile",
+		Usage: "CA certificate output file",
+		Value: "ca.crt",
+	}
 )
 
 func fetchCommand() *cli.Command {
@@ -27,8 +32,8 @@ func fetchCommand() *cli.Command {
 		Usage:  "Fetch certificates from DRIVR",
 		Before: checkAPIKey,
 		Subcommands: []*cli.Command{
-			fetchCertificateCommand(),
-			fetchCertificateAutorityCommand(),
+			withWaitFlags(withWriteFlags(fetchCertificateCommand())),
+			withWriteFlags(fetchCertificateAutorityCommand()),
 		},
 	}
 }
@@ -41,6 +46,7 @@ func fetchCertificateAutorityCommand() *cli.Command {
 		Flags: []cli.Flag{
 			issuerFlag,
 			drivrAPIURLFlag,
+			caOutfileFlag,
 		},
 	}
 }
@@ -50,10 +56,14 @@ func fetchCertificateCommand() *cli.Command {
 		Name:   "certificate",
 		Usage:  "Fetch a certificate",
 		Action: fetchCertificate,
-		Flags: []cli.Flag{
+		Flags: slices.Concat([]cli.Flag{
 			certificateUUIDFlag,
 			drivrAPIURLFlag,
-		},
+			certificateOutfileFlag,
+			privateKeyInfileFlag,
+			passphraseFileFlag,
+			waitFlag,
+		}, outputFlags, hookFlags),
 	}
 }
 
@@ -83,7 +93,7 @@ func fetchCertificateAutority(ctx *cli.Context) error {
 		logrus.WithError(err).Error("Failed to fetch CA certificate")
 		return err
 	}
-	err = cert.WriteToPEMFile(cert.Certificate, ca, "ca.crt")
+	err = cert.WriteToPEMFile(cert.Certificate, ca, outputPath(ctx, ctx.String(caOutfileFlag.Name)), writeOptionsFromFlags(ctx))
 	if err != nil {
 		logrus.WithError(err).Error("Failed writing CA certificate to file")
 		return err
@@ -105,26 +115,63 @@ func fetchCertificate(ctx *cli.Context) error {
 		return errors.New("invalid certificate UUID")
 	}
 
+	privateKeyFile := ctx.String(privateKeyInfileFlag.Name)
+	outputFormat, err := outputFormatFromFlags(ctx, privateKeyFile)
+	if err != nil {
+		return err
+	}
+
+	hooks, err := hookRunnerFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+
 	drivrAPI, err := api.NewDrivrAPI(apiURL, getAPIKey())
 	if err != nil {
 		logrus.WithError(err).Error("Failed to initialize DRIVR API Client")
 		return err
 	}
 
-	certificate, name, err := drivrAPI.FetchCertificate(ctx.Context, &certificateUUID)
+	var certificate []byte
+	var name string
+	if ctx.Bool(waitFlag.Name) {
+		certificate, name, err = waitForCertificate(ctx.Context, drivrAPI, &certificateUUID, waitOptionsFromFlags(ctx))
+	} else {
+		certificate, name, err = drivrAPI.FetchCertificate(ctx.Context, &certificateUUID)
+	}
 	if err != nil {
 		logrus.WithError(err).Error("Failed to fetch certificate")
 		return err
 	}
 
-	certificateOutfile := ctx.String(certificateOutfileFlag.Name)
-	if certificateOutfile == "" {
-		certificateOutfile = fmt.Sprintf("%s.crt", name)
+	certificateOutfile, err := certificateOutfileFromFlags(ctx, name, outputFormat)
+	if err != nil {
+		return err
+	}
+	snapshot, err := hooks.snapshot(certificateOutfile)
+	if err != nil {
+		return err
 	}
-	if err = cert.WriteToPEMFile(cert.Certificate, certificate, certificateOutfile); err != nil {
-		logrus.WithField("filename", certificateOutfile).WithError(err).Error("Failed to write certificate to file")
+	if err := writeCertificateOutput(ctx, drivrAPI, outputFormat, &certificateUUID, certificate, name, privateKeyFile, certificateOutfile, writeOptionsFromFlags(ctx)); err != nil {
 		return err
 	}
 
-	return nil
+	event := hookEvent{
+		Event:           "fetch",
+		CertificateFile: certificateOutfile,
+		PrivateKeyFile:  privateKeyFile,
+		CertificateUUID: &certificateUUID,
+		Name:            name,
+		Certificate:     certificate,
+	}
+	if len(hooks.commands) > 0 {
+		details, err := drivrAPI.FetchCertificateDetails(ctx.Context, &certificateUUID)
+		if err != nil {
+			logrus.WithError(err).Warn("Failed to fetch certificate details for hooks")
+		} else {
+			event.EntityUUID = &details.EntityUUID
+			event.EntityType = string(details.EntityType)
+		}
+	}
+	return hooks.run(ctx.Context, event, snapshot)
 }
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"github.com/xcnt/drivr-certificate-client/cert"
+)
+
+var (
+	matchPrivateKeyFlag = &cli.StringFlag{
+		Name:    "private-key-infile",
+		Aliases: []string{"p"},
+		Usage:   "Private key to check the inspected certificates and certificate requests against",
+	}
+	jsonOutputFlag = &cli.BoolFlag{
+		Name:  "json",
+		Usage: "Print the result as JSON",
+	}
+)
+
+type inspectedFile struct {
+	File  string       `json:"file"`
+	Items []*cert.Info `json:"items"`
+}
+
+func inspectCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "inspect",
+		Usage:     "Show the contents of certificate, key, CSR or CA files",
+		ArgsUsage: "<file> [<file>...]",
+		Action:    inspectFiles,
+		Flags: []cli.Flag{
+			matchPrivateKeyFlag,
+			passphraseFileFlag,
+			pkcs11PINFileFlag,
+			jsonOutputFlag,
+		},
+	}
+}
+
+func inspectFiles(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return errors.New("at least one file must be given")
+	}
+
+	privateKeyFile := ctx.String(matchPrivateKeyFlag.Name)
+	if privateKeyFile != "" {
+		privKey, keyCloser, err := cert.OpenSigner(privateKeyFile, keyPassphraseFunc(ctx), pkcs11PINFunc(ctx))
+		if err != nil {
+			logrus.WithError(err).Error("Failed to load private key")
+			return err
+		}
+		defer keyCloser.Close()
+		return inspectAndPrint(ctx, func(info *cert.Info) { info.MatchKey(privKey) })
+	}
+
+	return inspectAndPrint(ctx, func(*cert.Info) {})
+}
+
+func inspectAndPrint(ctx *cli.Context, matchKey func(*cert.Info)) error {
+	var files []inspectedFile
+	for _, filename := range ctx.Args().Slice() {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			logrus.WithError(err).WithField("filename", filename).Error("Failed to read file")
+			return err
+		}
+		infos, err := cert.Inspect(data, keyPassphraseFunc(ctx))
+		if err != nil {
+			logrus.WithError(err).WithField("filename", filename).Error("Failed to inspect file")
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		for _, info := range infos {
+			if info.Type == cert.Certificate || info.Type == cert.CertificateRequest {
+				matchKey(info)
+			}
+		}
+		files = append(files, inspectedFile{File: filename, Items: infos})
+	}
+
+	if ctx.Bool(jsonOutputFlag.Name) {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(files)
+	}
+
+	for _, file := range files {
+		printInspectedFile(os.Stdout, file)
+	}
+	return nil
+}
+
+func printInspectedFile(w io.Writer, file inspectedFile) {
+	fmt.Fprintf(w, "%s:\n", file.File)
+	for _, info := range file.Items {
+		printField(w, "Type", string(info.Type))
+		printField(w, "Subject", info.Subject)
+		printField(w, "Issuer", info.Issuer)
+		printField(w, "Serial", info.SerialNumber)
+		if info.NotBefore != nil && info.NotAfter != nil {
+			printField(w, "Not before", info.NotBefore.Format(time.RFC3339))
+			printField(w, "Not after", info.NotAfter.Format(time.RFC3339))
+		}
+		if info.IsCA {
+			printField(w, "CA", "yes")
+		}
+		printField(w, "DNS names", strings.Join(info.DNSNames, ", "))
+		printField(w, "IP addresses", strings.Join(info.IPAddresses, ", "))
+		printField(w, "URIs", strings.Join(info.URIs, ", "))
+		printField(w, "Email", strings.Join(info.EmailAddresses, ", "))
+		printField(w, "Key usage", strings.Join(info.KeyUsage, ", "))
+		printField(w, "Ext key usage", strings.Join(info.ExtKeyUsage, ", "))
+		printField(w, "Signature", info.SignatureAlgorithm)
+		printField(w, "Public key", info.PublicKeyAlgorithm)
+		printField(w, "SHA-256", info.Fingerprints["sha256"])
+		printField(w, "SHA-1", info.Fingerprints["sha1"])
+		if info.KeyMatches != nil {
+			matches := "no"
+			if *info.KeyMatches {
+				matches = "yes"
+			}
+			printField(w, "Key matches", matches)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func printField(w io.Writer, name, value string) {
+	if value == "" {
+		return
+	}
+	fmt.Fprintf(w, "  %-14s %s\n", name+":", value)
+}
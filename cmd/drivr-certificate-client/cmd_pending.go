@@ -0,0 +1,292 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"github.com/xcnt/drivr-certificate-client/api"
+	"github.com/xcnt/drivr-certificate-client/bundle"
+	"github.com/xcnt/drivr-certificate-client/cert"
+)
+
+var (
+	allPendingFlag = &cli.BoolFlag{
+		Name:  "all",
+		Usage: "Apply to all unfinished certificate requests",
+	}
+	deleteCertificateFlag = &cli.BoolFlag{
+		Name:  "delete",
+		Usage: "Delete the requested certificates from DRIVR",
+	}
+)
+
+func pendingCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "pending",
+		Usage: "List, finish or abandon certificate requests of interrupted create certificate runs",
+		Subcommands: []*cli.Command{
+			pendingListCommand(),
+			withWaitFlags(pendingFinishCommand()),
+			pendingAbandonCommand(),
+		},
+	}
+}
+
+func pendingListCommand() *cli.Command {
+	return &cli.Command{
+		Name:   "list",
+		Usage:  "List unfinished certificate requests",
+		Action: listPending,
+		Flags: []cli.Flag{
+			journalDirFlag,
+		},
+	}
+}
+
+func pendingFinishCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "finish",
+		Usage:     "Request or wait for the certificates and write them like the interrupted runs would have",
+		ArgsUsage: "<id> [<id>...]",
+		Before:    checkAPIKey,
+		Action:    finishPending,
+		Flags: append([]cli.Flag{
+			journalDirFlag,
+			allPendingFlag,
+			drivrAPIURLFlag,
+			forceFlag,
+			backupFlag,
+			passphraseFileFlag,
+			exportPasswordFileFlag,
+			k8sSecretNameFlag,
+			k8sNamespaceFlag,
+			k8sLabelFlag,
+			k8sIncludeCAFlag,
+		}, hookFlags...),
+	}
+}
+
+func pendingAbandonCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "abandon",
+		Usage:     "Remove unfinished certificate requests from the journal",
+		ArgsUsage: "<id> [<id>...]",
+		Action:    abandonPending,
+		Flags: []cli.Flag{
+			journalDirFlag,
+			allPendingFlag,
+			deleteCertificateFlag,
+			optionalDrivrAPIURLFlag,
+		},
+	}
+}
+
+func listPending(ctx *cli.Context) error {
+	entries, err := journalFromFlags(ctx).List()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		logrus.Info("No unfinished certificate requests")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSTEP\tCERTIFICATE UUID\tCERTIFICATE FILE\tUPDATED")
+	for _, entry := range entries {
+		certificateUUID := ""
+		if entry.CertificateUUID != nil {
+			certificateUUID = entry.CertificateUUID.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.ID, entry.Name, entry.Step, certificateUUID,
+			entry.CertificateFile, entry.UpdatedAt.Local().Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+// selectPending returns the journal entries selected by the ID arguments, which may be abbreviated, or --all.
+func selectPending(ctx *cli.Context, journal bundle.Journal) ([]*bundle.JournalEntry, error) {
+	entries, err := journal.List()
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Bool(allPendingFlag.Name) {
+		if ctx.Args().Present() {
+			return nil, fmt.Errorf("IDs cannot be given with --%s", allPendingFlag.Name)
+		}
+		return entries, nil
+	}
+	if !ctx.Args().Present() {
+		return nil, fmt.Errorf("IDs or --%s required", allPendingFlag.Name)
+	}
+
+	var selected []*bundle.JournalEntry
+	for _, id := range ctx.Args().Slice() {
+		var matches []*bundle.JournalEntry
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.ID, id) {
+				matches = append(matches, entry)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			return nil, fmt.Errorf("no unfinished certificate request %s", id)
+		case 1:
+			selected = append(selected, matches[0])
+		default:
+			return nil, fmt.Errorf("ID %s is ambiguous", id)
+		}
+	}
+	return selected, nil
+}
+
+func finishPending(ctx *cli.Context) error {
+	journal := journalFromFlags(ctx)
+	entries, err := selectPending(ctx, journal)
+	if err != nil {
+		return err
+	}
+
+	drivrAPI, err := drivrAPIFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+
+	hooks, err := hookRunnerFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		log := logrus.WithField("journal_id", entry.ID).WithField("name", entry.Name)
+		if err := finishJournalEntry(ctx, drivrAPI, journal, entry, hooks); err != nil {
+			log.WithError(err).Error("Failed to finish certificate request")
+			errs = append(errs, err)
+			continue
+		}
+		log.WithField("certificate_file", entry.CertificateFile).Info("Certificate written")
+	}
+	return errors.Join(errs...)
+}
+
+// finishJournalEntry requests the certificate of the entry if that has not happened yet, waits until it is
+// signed and writes it with the recorded output format and, if requested, its metadata. The hooks are run
+// like after create certificate.
+func finishJournalEntry(ctx *cli.Context, drivrAPI *api.DrivrAPI, journal bundle.Journal, entry *bundle.JournalEntry, hooks *hookRunner) error {
+	format, err := cert.ParseOutputFormat(entry.OutputFormat)
+	if err != nil {
+		return err
+	}
+	writeOptions := writeOptionsFromFlags(ctx)
+	if err := cert.CheckWritable(entry.CertificateFile, writeOptions); err != nil {
+		return err
+	}
+
+	request := journalRequest(entry)
+	certificateUUID := entry.CertificateUUID
+	if certificateUUID == nil {
+		certificateUUID, err = requestCertificate(ctx.Context, drivrAPI, request)
+		if err != nil {
+			return err
+		}
+		journalRequested(journal, entry, request, certificateUUID)
+	}
+
+	certificate, _, err := waitForCertificate(ctx.Context, drivrAPI, certificateUUID, waitOptionsFromFlags(ctx))
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := hooks.snapshot(entry.CertificateFile, bundle.MetadataFilename(entry.CertificateFile))
+	if err != nil {
+		return err
+	}
+
+	if err := writeCertificateOutput(ctx, drivrAPI, format, certificateUUID, certificate, entry.Name, entry.PrivateKey, entry.CertificateFile, writeOptions); err != nil {
+		return err
+	}
+
+	if entry.WriteMetadata {
+		usages := []string{string(api.CertificateUsageClientAuth)}
+		if entry.ServerUse {
+			usages = append(usages, string(api.CertificateUsageServerAuth))
+		}
+		err := bundle.WriteMetadata(&bundle.Metadata{
+			CertificateUUID: *certificateUUID,
+			Name:            entry.Name,
+			SystemCode:      entry.SystemCode,
+			ComponentCode:   entry.ComponentCode,
+			Issuer:          entry.Issuer,
+			Duration:        entry.Duration,
+			Usages:          usages,
+			PrivateKey:      entry.PrivateKey,
+			IssuedAt:        time.Now().UTC(),
+		}, entry.CertificateFile, writeOptions)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := journal.Remove(entry.ID); err != nil {
+		return err
+	}
+
+	return hooks.run(ctx.Context, hookEvent{
+		Event:           "create",
+		CertificateFile: entry.CertificateFile,
+		PrivateKeyFile:  entry.PrivateKey,
+		CertificateUUID: certificateUUID,
+		Name:            entry.Name,
+		EntityUUID:      entry.EntityUUID,
+		SystemCode:      entry.SystemCode,
+		ComponentCode:   entry.ComponentCode,
+		Certificate:     certificate,
+	}, snapshot)
+}
+
+func abandonPending(ctx *cli.Context) error {
+	journal := journalFromFlags(ctx)
+	entries, err := selectPending(ctx, journal)
+	if err != nil {
+		return err
+	}
+
+	var drivrAPI *api.DrivrAPI
+	if ctx.Bool(deleteCertificateFlag.Name) {
+		if err := checkAPIKey(ctx); err != nil {
+			return err
+		}
+		if ctx.String(optionalDrivrAPIURLFlag.Name) == "" {
+			return fmt.Errorf("%s must be specified to delete certificates", optionalDrivrAPIURLFlag.Name)
+		}
+		drivrAPI, err = drivrAPIFromFlags(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		log := logrus.WithField("journal_id", entry.ID).WithField("name", entry.Name)
+		if drivrAPI != nil && entry.CertificateUUID != nil {
+			if err := drivrAPI.DeleteCertificate(ctx.Context, entry.CertificateUUID); err != nil && !errors.Is(err, api.ErrNotFound) {
+				errs = append(errs, err)
+				continue
+			}
+			log.WithField("certificate_uuid", entry.CertificateUUID).Info("Certificate deleted from DRIVR")
+		}
+		if err := journal.Remove(entry.ID); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		log.Info("Certificate request abandoned")
+	}
+	return errors.Join(errs...)
+}
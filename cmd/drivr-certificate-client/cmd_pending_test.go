@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/urfave/cli/v2"
+	"github.com/xcnt/drivr-certificate-client/bundle"
+)
+
+// fakeDeleteServer answers deleteCertificate mutations and records the deleted certificates.
+type fakeDeleteServer struct {
+	mu sync.Mutex
+	// responses maps certificate UUIDs to notFound or failed, all others are deleted.
+	responses map[string]string
+	deleted   []string
+}
+
+func (s *fakeDeleteServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		OperationName string         `json:"operationName"`
+		Variables     map[string]any `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.OperationName != "deleteCertificate" {
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	certificateUUID, _ := request.Variables["uuid"].(string)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch s.responses[certificateUUID] {
+	case "notFound":
+		w.Write([]byte(`{"data": null, "errors": [{"message": "certificate not found", "extensions": {"code": "NOT_FOUND"}}]}`))
+	case "failed":
+		http.Error(w, `{"errors": [{"message": "internal error"}]}`, http.StatusInternalServerError)
+	default:
+		s.deleted = append(s.deleted, certificateUUID)
+		w.Write([]byte(`{"data": {"deleteCertificate": {"__typename": "EmptyResult"}}}`))
+	}
+}
+
+func TestAbandonPending(t *testing.T) {
+	t.Setenv(drivrAPIKeyEnv, "test")
+
+	first := uuid.New()
+	second := uuid.New()
+	entries := []*bundle.JournalEntry{
+		{ID: "aa01", Name: "first", Step: bundle.JournalRequested, CertificateUUID: &first},
+		{ID: "aa02", Name: "second", Step: bundle.JournalRequested, CertificateUUID: &second},
+		{ID: "bb01", Name: "prepared", Step: bundle.JournalPrepared},
+	}
+
+	tests := []struct {
+		name        string
+		args        []string
+		responses   map[string]string
+		wantErr     bool
+		wantDeleted []string
+		wantKept    []string
+	}{
+		{name: "journal only", args: []string{"aa01"}, wantKept: []string{"aa02", "bb01"}},
+		{name: "delete", args: []string{"--delete", "aa01"}, wantDeleted: []string{first.String()}, wantKept: []string{"aa02", "bb01"}},
+		{name: "delete prepared request", args: []string{"--delete", "bb"}, wantKept: []string{"aa01", "aa02"}},
+		{name: "delete all", args: []string{"--delete", "--all"}, wantDeleted: []string{first.String(), second.String()}},
+		{
+			name:      "already deleted",
+			args:      []string{"--delete", "aa01"},
+			responses: map[string]string{first.String(): "notFound"},
+			wantKept:  []string{"aa02", "bb01"},
+		},
+		{
+			name:        "failed deletion keeps the entry",
+			args:        []string{"--delete", "--all"},
+			responses:   map[string]string{first.String(): "failed"},
+			wantErr:     true,
+			wantDeleted: []string{second.String()},
+			wantKept:    []string{"aa01"},
+		},
+		{name: "ambiguous ID", args: []string{"--delete", "aa"}, wantErr: true, wantKept: []string{"aa01", "aa02", "bb01"}},
+		{name: "unknown ID", args: []string{"--delete", "aa01", "cc"}, wantErr: true, wantKept: []string{"aa01", "aa02", "bb01"}},
+		{name: "no ID", args: []string{"--delete"}, wantErr: true, wantKept: []string{"aa01", "aa02", "bb01"}},
+		{name: "IDs with all", args: []string{"--all", "aa01"}, wantErr: true, wantKept: []string{"aa01", "aa02", "bb01"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			journal := bundle.Journal{Dir: t.TempDir()}
+			for _, entry := range entries {
+				entry := *entry
+				if err := journal.Save(&entry); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			server := &fakeDeleteServer{responses: tt.responses}
+			httpServer := httptest.NewServer(server)
+			defer httpServer.Close()
+
+			app := &cli.App{Name: "drivr-certificate-client", Commands: []*cli.Command{pendingCommand()}}
+			args := append([]string{"drivr-certificate-client", "pending", "abandon", "--journal-dir", journal.Dir, "--drivr-api", httpServer.URL}, tt.args...)
+			err := app.Run(args)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+
+			slices.Sort(server.deleted)
+			slices.Sort(tt.wantDeleted)
+			if !slices.Equal(server.deleted, tt.wantDeleted) {
+				t.Errorf("deleted %v, want %v", server.deleted, tt.wantDeleted)
+			}
+
+			remaining, err := journal.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var kept []string
+			for _, entry := range remaining {
+				kept = append(kept, entry.ID)
+			}
+			slices.Sort(kept)
+			if !slices.Equal(kept, tt.wantKept) {
+				t.Errorf("kept %v, want %v", kept, tt.wantKept)
+			}
+		})
+	}
+}
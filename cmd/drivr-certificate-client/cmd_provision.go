@@ -0,0 +1,429 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"github.com/xcnt/drivr-certificate-client/api"
+	"github.com/xcnt/drivr-certificate-client/bundle"
+	"github.com/xcnt/drivr-certificate-client/cert"
+)
+
+var (
+	manifestFlag = &cli.StringFlag{
+		Name:     "manifest",
+		Aliases:  []string{"m"},
+		Usage:    "YAML or CSV file listing the certificates to provision",
+		Required: true,
+	}
+	stateFileFlag = &cli.StringFlag{
+		Name:  "state-file",
+		Usage: "File recording the progress, used to resume an interrupted run. Defaults to the manifest file name, or with --select to the certificate name, with the extension .state.json",
+	}
+	reportFlag = &cli.StringFlag{
+		Name:  "report",
+		Usage: "Write a summary report to this file, as CSV if it ends with .csv, otherwise as JSON",
+	}
+	concurrencyFlag = &cli.IntFlag{
+		Name:  "concurrency",
+		Value: 4,
+		Usage: "Number of certificates which are requested at the same time",
+	}
+)
+
+func provisionCommand() *cli.Command {
+	return withWaitFlags(withWriteFlags(&cli.Command{
+		Name:  "provision",
+		Usage: "Issue the certificates listed in a manifest file",
+		Description: "For every entry of the manifest a private key <name>.key and the certificate <name>.crt are written. " +
+			"Existing keys are reused. The progress is recorded in the state file, running the command again resumes an interrupted run " +
+			"and retries failed entries without requesting issued certificates twice.",
+		Before: combinedCheckFuncs(checkAPIKey, checkProvisionFlags),
+		Action: provision,
+		Flags: []cli.Flag{
+			manifestFlag,
+			stateFileFlag,
+			reportFlag,
+			concurrencyFlag,
+			drivrAPIURLFlag,
+			issuerFlag,
+			certificateDurationFlag,
+			keyAlgorithmFlag,
+			keyBitsFlag,
+			encryptKeyFlag,
+			passphraseFileFlag,
+			pkcs11PINFileFlag,
+			writeMetadataFlag,
+		},
+	}))
+}
+
+func checkProvisionFlags(ctx *cli.Context) error {
+	if ctx.Int(concurrencyFlag.Name) < 1 {
+		return fmt.Errorf("%s must be at least 1", concurrencyFlag.Name)
+	}
+	return nil
+}
+
+// Results of a manifest entry in the provisioning report.
+const (
+	provisionResultIssued      = "issued"
+	provisionResultSkipped     = "skipped"
+	provisionResultFailed      = "failed"
+	provisionResultInterrupted = "interrupted"
+)
+
+// provisionResult is a line of the provisioning report.
+type provisionResult struct {
+	Name            string     `json:"name"`
+	SystemCode      string     `json:"systemCode,omitempty"`
+	ComponentCode   string     `json:"componentCode,omitempty"`
+	Result          string     `json:"result"`
+	CertificateUUID *uuid.UUID `json:"certificateUuid,omitempty"`
+	CertificateFile string     `json:"certificateFile,omitempty"`
+	Error           string     `json:"error,omitempty"`
+}
+
+// provisioner issues the certificates of a manifest and records the progress in the state file.
+type provisioner struct {
+	ctx       *cli.Context
+	drivrAPI  *api.DrivrAPI
+	stateFile string
+	wait      waitOptions
+	write     cert.WriteOptions
+
+	mu    sync.Mutex
+	state *bundle.ProvisionState
+}
+
+func provision(ctx *cli.Context) error {
+	manifestFile := ctx.String(manifestFlag.Name)
+	manifest, err := bundle.LoadManifest(manifestFile)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to load manifest")
+		return err
+	}
+
+	stateFile := ctx.String(stateFileFlag.Name)
+	if stateFile == "" {
+		stateFile = strings.TrimSuffix(manifestFile, filepath.Ext(manifestFile)) + ".state.json"
+	}
+	state, err := bundle.LoadProvisionState(stateFile)
+	if err != nil {
+		logrus.WithError(err).WithField("filename", stateFile).Error("Failed to load state file")
+		return err
+	}
+
+	drivrAPI, err := drivrAPIFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+
+	results, err := provisionEntries(ctx, drivrAPI, manifest.Certificates, state, stateFile)
+	if err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		logrus.Warn("Provisioning interrupted, run the command again to resume")
+	}
+
+	printProvisionSummary(results)
+	if reportFile := ctx.String(reportFlag.Name); reportFile != "" {
+		if err := writeProvisionReport(results, outputPath(ctx, reportFile)); err != nil {
+			logrus.WithError(err).WithField("filename", reportFile).Error("Failed to write report")
+			return err
+		}
+	}
+	return provisionError(results)
+}
+
+// provisionEntries issues the certificates of the entries with bounded concurrency and returns a result per entry.
+// The progress is recorded in the state, which is saved to the state file unless it is empty.
+func provisionEntries(ctx *cli.Context, drivrAPI *api.DrivrAPI, entries []bundle.ManifestEntry, state *bundle.ProvisionState, stateFile string) ([]provisionResult, error) {
+	// prompt for the passphrase once instead of in every worker
+	if ctx.Bool(encryptKeyFlag.Name) {
+		if _, err := getKeyPassphrase(ctx, true); err != nil {
+			return nil, err
+		}
+	}
+
+	p := &provisioner{ctx: ctx, drivrAPI: drivrAPI, stateFile: stateFile, wait: waitOptionsFromFlags(ctx), write: writeOptionsFromFlags(ctx), state: state}
+
+	results := make([]provisionResult, len(entries))
+	for i, entry := range entries {
+		results[i] = provisionResult{
+			Name:          entry.Name,
+			SystemCode:    entry.SystemCode,
+			ComponentCode: entry.ComponentCode,
+			Result:        provisionResultInterrupted,
+		}
+	}
+
+	logrus.WithField("certificates", len(entries)).Info("Provisioning certificates")
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(ctx.Int(concurrencyFlag.Name), len(entries)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				p.provisionEntry(entries[i], &results[i])
+			}
+		}()
+	}
+dispatch:
+	for i := range entries {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results, nil
+}
+
+// provisionError returns an error if not all certificates have been provisioned.
+func provisionError(results []provisionResult) error {
+	for _, result := range results {
+		if result.Result == provisionResultFailed || result.Result == provisionResultInterrupted {
+			return errors.New("not all certificates could be provisioned")
+		}
+	}
+	return nil
+}
+
+// provisionEntry issues the certificate of a manifest entry, or resumes waiting for a certificate
+// which was requested in an earlier run.
+func (p *provisioner) provisionEntry(entry bundle.ManifestEntry, result *provisionResult) {
+	ctx := p.ctx
+	if ctx.Err() != nil {
+		return
+	}
+	log := logrus.WithField("name", entry.Name)
+
+	certificateFile := outputPath(ctx, entry.Name+".crt")
+	privateKeyFile := outputPath(ctx, entry.Name+".key")
+	result.CertificateFile = certificateFile
+
+	status := p.status(entry.Name)
+	if status != nil && status.Status == bundle.ProvisionIssued {
+		if _, err := os.Stat(certificateFile); err == nil {
+			log.Debug("Certificate already issued")
+			result.Result = provisionResultSkipped
+			result.CertificateUUID = status.CertificateUUID
+			return
+		}
+	}
+
+	request := &certificateRequest{
+		Name:          entry.Name,
+		SystemCode:    entry.SystemCode,
+		ComponentCode: entry.ComponentCode,
+		EntityUUID:    entry.EntityUUID,
+		Issuer:        entry.Issuer,
+		Duration:      entry.Duration,
+		ServerUse:     entry.ServerName != "",
+	}
+	if request.Issuer == "" {
+		request.Issuer = ctx.String(issuerFlag.Name)
+	}
+	if request.Duration == "" {
+		request.Duration = ctx.String(certificateDurationFlag.Name)
+	}
+
+	var certificateUUID *uuid.UUID
+	if status != nil && status.Status == bundle.ProvisionRequested && status.CertificateUUID != nil {
+		log.WithField("certificate_uuid", status.CertificateUUID).Info("Resuming requested certificate")
+		certificateUUID = status.CertificateUUID
+	} else {
+		var err error
+		certificateUUID, err = p.requestEntry(entry, request, certificateFile, privateKeyFile)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.WithError(err).Error("Failed to request certificate")
+				p.setStatus(entry.Name, bundle.ProvisionFailed, nil, err)
+				result.Result = provisionResultFailed
+				result.Error = err.Error()
+			}
+			return
+		}
+		log.WithField("certificate_uuid", certificateUUID).Info("Certificate requested")
+	}
+	result.CertificateUUID = certificateUUID
+
+	// failures from here on keep the requested state, so the certificate is fetched instead of requested again
+	if err := p.writeEntry(entry, request, certificateUUID, certificateFile, privateKeyFile); err != nil {
+		if ctx.Err() == nil {
+			log.WithError(err).Error("Failed to write certificate")
+			p.setStatus(entry.Name, bundle.ProvisionRequested, certificateUUID, err)
+			result.Result = provisionResultFailed
+			result.Error = err.Error()
+		}
+		return
+	}
+
+	p.setStatus(entry.Name, bundle.ProvisionIssued, certificateUUID, nil)
+	result.Result = provisionResultIssued
+	log.Info("Certificate issued")
+}
+
+// requestEntry creates the private key and CSR of the entry and requests the certificate.
+func (p *provisioner) requestEntry(entry bundle.ManifestEntry, request *certificateRequest, certificateFile, privateKeyFile string) (*uuid.UUID, error) {
+	ctx := p.ctx
+	if err := cert.CheckWritable(certificateFile, p.write); err != nil {
+		return nil, err
+	}
+
+	csrData := &cert.CSRData{
+		CommonName: entry.CommonName,
+		ServerName: entry.ServerName,
+		DNSNames:   entry.DNSNames,
+	}
+	for _, address := range entry.IPAddresses {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %s", address)
+		}
+		csrData.IPAddresses = append(csrData.IPAddresses, ip)
+	}
+
+	if err := ensurePrivateKey(ctx, privateKeyFile); err != nil {
+		return nil, err
+	}
+	privKey, keyCloser, err := cert.OpenSigner(privateKeyFile, keyPassphraseFunc(ctx), pkcs11PINFunc(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer keyCloser.Close()
+
+	if request.CSR, err = cert.CreateCSR(privKey, csrData); err != nil {
+		return nil, err
+	}
+
+	certificateUUID, err := requestCertificate(ctx.Context, p.drivrAPI, request)
+	if err != nil {
+		return nil, err
+	}
+	p.setStatus(entry.Name, bundle.ProvisionRequested, certificateUUID, nil)
+	return certificateUUID, nil
+}
+
+// writeEntry waits for the requested certificate and writes it and, if enabled, its metadata.
+func (p *provisioner) writeEntry(entry bundle.ManifestEntry, request *certificateRequest, certificateUUID *uuid.UUID, certificateFile, privateKeyFile string) error {
+	ctx := p.ctx
+	certificate, _, err := waitForCertificate(ctx.Context, p.drivrAPI, certificateUUID, p.wait)
+	if err != nil {
+		return err
+	}
+
+	if err := writeCertificateOutput(ctx, p.drivrAPI, cert.Leaf, certificateUUID, certificate, entry.Name, privateKeyFile, certificateFile, p.write); err != nil {
+		return err
+	}
+
+	if !ctx.Bool(writeMetadataFlag.Name) {
+		return nil
+	}
+	usages := []string{string(api.CertificateUsageClientAuth)}
+	if request.ServerUse {
+		usages = append(usages, string(api.CertificateUsageServerAuth))
+	}
+	return bundle.WriteMetadata(&bundle.Metadata{
+		CertificateUUID: *certificateUUID,
+		Name:            entry.Name,
+		SystemCode:      entry.SystemCode,
+		ComponentCode:   entry.ComponentCode,
+		EntityUUID:      entry.EntityUUID,
+		Issuer:          request.Issuer,
+		Duration:        request.Duration,
+		Usages:          usages,
+		PrivateKey:      privateKeyFile,
+		IssuedAt:        time.Now().UTC(),
+	}, certificateFile, p.write)
+}
+
+func (p *provisioner) status(name string) *bundle.ProvisionStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state.Certificates[name]
+}
+
+// setStatus records the progress of an entry and saves the state file.
+func (p *provisioner) setStatus(name, status string, certificateUUID *uuid.UUID, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry := &bundle.ProvisionStatus{
+		Status:          status,
+		CertificateUUID: certificateUUID,
+		UpdatedAt:       time.Now().UTC(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	p.state.Certificates[name] = entry
+
+	if p.stateFile == "" {
+		return
+	}
+	if err := p.state.Save(p.stateFile); err != nil {
+		logrus.WithError(err).WithField("filename", p.stateFile).Error("Failed to save state file")
+	}
+}
+
+func printProvisionSummary(results []provisionResult) {
+	counts := map[string]int{}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tRESULT\tCERTIFICATE UUID\tERROR")
+	for _, result := range results {
+		counts[result.Result]++
+		certificateUUID := ""
+		if result.CertificateUUID != nil {
+			certificateUUID = result.CertificateUUID.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", result.Name, result.Result, certificateUUID, result.Error)
+	}
+	w.Flush()
+	fmt.Printf("\n%d issued, %d skipped, %d failed, %d interrupted\n",
+		counts[provisionResultIssued], counts[provisionResultSkipped], counts[provisionResultFailed], counts[provisionResultInterrupted])
+}
+
+func writeProvisionReport(results []provisionResult, filename string) error {
+	if !strings.EqualFold(filepath.Ext(filename), ".csv") {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		return cert.ReplaceFile(append(data, '\n'), filename, 0644)
+	}
+
+	var buffer strings.Builder
+	writer := csv.NewWriter(&buffer)
+	writer.Write([]string{"name", "system_code", "component_code", "result", "certificate_uuid", "certificate_file", "error"})
+	for _, result := range results {
+		certificateUUID := ""
+		if result.CertificateUUID != nil {
+			certificateUUID = result.CertificateUUID.String()
+		}
+		writer.Write([]string{result.Name, result.SystemCode, result.ComponentCode, result.Result, certificateUUID, result.CertificateFile, result.Error})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return cert.ReplaceFile([]byte(buffer.String()), filename, 0644)
+}
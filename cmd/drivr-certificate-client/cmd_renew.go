@@ -0,0 +1,397 @@
+package main
+
+import (
+	"crypto"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"github.com/xcnt/drivr-certificate-client/api"
+	"github.com/xcnt/drivr-certificate-client/bundle"
+	"github.com/xcnt/drivr-certificate-client/cert"
+)
+
+const renewalTimestampFormat = "20060102T150405Z"
+
+var renewalSuffix = regexp.MustCompile(`-\d{8}T\d{6}Z$`)
+
+var (
+	rotateKeyFlag = &cli.BoolFlag{
+		Name:  "rotate-key",
+		Usage: "Generate a new private key of the same type instead of reusing the existing one",
+	}
+	renewNameFlag = &cli.StringFlag{
+		Name:    nameFlag.Name,
+		Aliases: nameFlag.Aliases,
+		Usage:   "Name of the renewed certificate. Defaults to the previous name with a timestamp suffix",
+	}
+	writeMetadataFlag = &cli.BoolFlag{
+		Name:  "write-metadata",
+		Usage: "Write a metadata file next to the certificate, which is used to renew it",
+	}
+)
+
+func renewCommand() *cli.Command {
+	return withWaitFlags(&cli.Command{
+		Name:   "renew",
+		Usage:  "Replace an existing certificate with a newly issued one",
+		Before: checkAPIKey,
+		Action: renewCertificate,
+		Flags: append([]cli.Flag{
+			certificateInfileFlag,
+			privateKeyInfileFlag,
+			passphraseFileFlag,
+			pkcs11PINFileFlag,
+			rotateKeyFlag,
+			renewNameFlag,
+			certificateDurationFlag,
+			drivrAPIURLFlag,
+			backupFlag,
+			writeMetadataFlag,
+		}, hookFlags...),
+	})
+}
+
+// renewWriteOptions allows renewals to replace the existing files.
+func renewWriteOptions(ctx *cli.Context) cert.WriteOptions {
+	return cert.WriteOptions{
+		Force:  true,
+		Backup: ctx.Bool(backupFlag.Name),
+	}
+}
+
+// renewTarget describes a certificate file which should be renewed.
+type renewTarget struct {
+	CertificateFile string
+	// PrivateKey defaults to the key recorded in the metadata file.
+	PrivateKey string
+	RotateKey  bool
+	// Name defaults to the previous name with a new timestamp suffix.
+	Name string
+	// Duration defaults to the duration of the previous certificate.
+	Duration      string
+	WriteMetadata bool
+	// Hooks are run after the files have been replaced.
+	Hooks *hookRunner
+	// Wait controls waiting for the renewed certificate to be signed.
+	Wait waitOptions
+	// Write controls how the replaced files are written.
+	Write cert.WriteOptions
+}
+
+func renewCertificate(ctx *cli.Context) error {
+	certificateFile := ctx.String(certificateInfileFlag.Name)
+	if certificateFile == "" {
+		return fmt.Errorf("certificate file must be specified")
+	}
+
+	target := renewTarget{
+		CertificateFile: certificateFile,
+		RotateKey:       ctx.Bool(rotateKeyFlag.Name),
+		Name:            ctx.String(renewNameFlag.Name),
+		WriteMetadata:   ctx.Bool(writeMetadataFlag.Name),
+		Wait:            waitOptionsFromFlags(ctx),
+		Write:           renewWriteOptions(ctx),
+	}
+	if ctx.IsSet(privateKeyInfileFlag.Name) {
+		target.PrivateKey = ctx.String(privateKeyInfileFlag.Name)
+	}
+	if ctx.IsSet(certificateDurationFlag.Name) {
+		target.Duration = ctx.String(certificateDurationFlag.Name)
+	}
+	hooks, err := hookRunnerFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+	target.Hooks = hooks
+
+	drivrAPI, err := drivrAPIFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := renewCertificateFile(ctx, drivrAPI, target)
+	if err != nil {
+		return err
+	}
+	logrus.WithField("certificate_uuid", metadata.CertificateUUID).WithField("name", metadata.Name).Info("Certificate renewed")
+	return nil
+}
+
+// drivrAPIFromFlags creates a DRIVR API client for the API URL given on the command line.
+func drivrAPIFromFlags(ctx *cli.Context) (*api.DrivrAPI, error) {
+	apiURL, err := url.Parse(getAPIUrl(ctx))
+	if err != nil {
+		logrus.WithError(err).Error("Failed to parse GraphQL API URL")
+		return nil, err
+	}
+	drivrAPI, err := api.NewDrivrAPI(apiURL, getAPIKey())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to initialize DRIVR API Client")
+		return nil, err
+	}
+	return drivrAPI, nil
+}
+
+// renewCertificateFile requests a replacement for the certificate file with the same entity, issuer, usages
+// and subject, waits until it is signed and replaces the certificate file and, if rotated, the private key.
+// The request details are taken from the metadata file or looked up in DRIVR.
+func renewCertificateFile(ctx *cli.Context, drivrAPI *api.DrivrAPI, target renewTarget) (*bundle.Metadata, error) {
+	log := logrus.WithField("filename", target.CertificateFile)
+
+	data, err := os.ReadFile(target.CertificateFile)
+	if err != nil {
+		log.WithError(err).Error("Failed to read certificate")
+		return nil, err
+	}
+	current, err := cert.ParseCertificate(data)
+	if err != nil {
+		log.WithError(err).Error("Failed to parse certificate")
+		return nil, err
+	}
+	format := cert.DetectOutputFormat(data)
+
+	metadata, err := loadRenewMetadata(ctx, drivrAPI, target.CertificateFile, current.Raw)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKeyFile := target.PrivateKey
+	if privateKeyFile == "" {
+		privateKeyFile = metadata.PrivateKey
+	}
+	if privateKeyFile == "" {
+		privateKeyFile = privateKeyInfileFlag.Value
+	}
+
+	var signer crypto.Signer
+	var rotatedKeyOptions cert.KeyOptions
+	if target.RotateKey {
+		signer, rotatedKeyOptions, err = generateRotatedKey(ctx, privateKeyFile, current.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		privKey, keyCloser, err := cert.OpenSigner(privateKeyFile, keyPassphraseFunc(ctx), pkcs11PINFunc(ctx))
+		if err != nil {
+			log.WithError(err).Error("Failed to load private key")
+			return nil, err
+		}
+		defer keyCloser.Close()
+		if !cert.PublicKeysEqual(privKey.Public(), current.PublicKey) {
+			return nil, fmt.Errorf("private key %s does not match certificate %s", privateKeyFile, target.CertificateFile)
+		}
+		signer = privKey
+	}
+
+	csr, err := cert.CreateCSR(signer, cert.CSRDataFromCertificate(current))
+	if err != nil {
+		log.WithError(err).Error("Failed to generate CSR")
+		return nil, err
+	}
+
+	name := target.Name
+	if name == "" {
+		if metadata.Name == "" {
+			return nil, errors.New("name of the certificate is unknown")
+		}
+		name = renewalName(metadata.Name)
+	}
+	duration := target.Duration
+	if duration == "" {
+		duration = metadata.Duration
+	}
+
+	request := &certificateRequest{
+		Name:          name,
+		SystemCode:    metadata.SystemCode,
+		ComponentCode: metadata.ComponentCode,
+		Issuer:        metadata.Issuer,
+		Duration:      duration,
+		ServerUse:     slices.Contains(metadata.Usages, string(api.CertificateUsageServerAuth)),
+		EntityUUID:    metadata.EntityUUID,
+		CSR:           csr,
+	}
+
+	log.WithField("name", name).Info("Requesting replacement certificate")
+	certificate, certificateUUID, err := issueCertificate(ctx.Context, drivrAPI, request, target.Wait)
+	if err != nil {
+		return nil, err
+	}
+
+	// all files are restored if any of them cannot be written, so the key always matches the certificate
+	snapshotFiles := []string{target.CertificateFile, bundle.MetadataFilename(target.CertificateFile)}
+	if target.RotateKey {
+		snapshotFiles = append(snapshotFiles, privateKeyFile)
+	}
+	snapshot, err := cert.SnapshotFiles(snapshotFiles...)
+	if err != nil {
+		return nil, err
+	}
+	restore := func(err error) (*bundle.Metadata, error) {
+		if restoreErr := snapshot.Restore(); restoreErr != nil {
+			return nil, errors.Join(err, restoreErr)
+		}
+		return nil, err
+	}
+
+	// the rotated key replaces the existing one last, output formats embedding the key read it from a temporary file
+	outputKeyFile := privateKeyFile
+	var rotatedKey []byte
+	if target.RotateKey {
+		rotatedKey, err = cert.EncodePrivateKey(signer, rotatedKeyOptions)
+		if err != nil {
+			return nil, err
+		}
+		outputKeyFile, err = writeTemporaryKey(rotatedKey, privateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(outputKeyFile)
+	}
+
+	if err := writeCertificateOutput(ctx, drivrAPI, format, certificateUUID, certificate, name, outputKeyFile, target.CertificateFile, target.Write); err != nil {
+		return restore(err)
+	}
+
+	metadata.CertificateUUID = *certificateUUID
+	metadata.Name = name
+	metadata.Duration = duration
+	metadata.PrivateKey = privateKeyFile
+	metadata.IssuedAt = time.Now().UTC()
+	if metadata.fromFile || target.WriteMetadata {
+		if err := bundle.WriteMetadata(&metadata.Metadata, target.CertificateFile, target.Write); err != nil {
+			return restore(err)
+		}
+	}
+
+	if target.RotateKey {
+		if err := cert.WriteToFile(rotatedKey, privateKeyFile, true, target.Write); err != nil {
+			logrus.WithError(err).WithField("filename", privateKeyFile).Error("Failed to write private key to file")
+			return restore(err)
+		}
+	}
+
+	err = target.Hooks.run(ctx.Context, hookEvent{
+		Event:           "renew",
+		CertificateFile: target.CertificateFile,
+		PrivateKeyFile:  privateKeyFile,
+		CertificateUUID: certificateUUID,
+		Name:            name,
+		EntityUUID:      request.EntityUUID,
+		SystemCode:      metadata.SystemCode,
+		ComponentCode:   metadata.ComponentCode,
+		Certificate:     certificate,
+	}, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return &metadata.Metadata, nil
+}
+
+// renewMetadata are the request details of a certificate which is renewed.
+type renewMetadata struct {
+	bundle.Metadata
+	fromFile bool
+}
+
+// loadRenewMetadata reads the metadata file of the certificate or looks up the certificate in DRIVR.
+func loadRenewMetadata(ctx *cli.Context, drivrAPI *api.DrivrAPI, certificateFile string, certificate []byte) (*renewMetadata, error) {
+	if _, err := os.Stat(bundle.MetadataFilename(certificateFile)); err == nil {
+		metadata, err := bundle.LoadMetadata(certificateFile)
+		if err != nil {
+			return nil, err
+		}
+		logrus.WithField("filename", bundle.MetadataFilename(certificateFile)).Debug("Using certificate metadata file")
+		return &renewMetadata{Metadata: *metadata, fromFile: true}, nil
+	}
+
+	logrus.WithField("filename", certificateFile).Debug("No metadata file found, looking up certificate in DRIVR")
+	details, err := drivrAPI.FindCertificate(ctx.Context, certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &renewMetadata{
+		Metadata: bundle.Metadata{
+			CertificateUUID: details.UUID,
+			Name:            details.Name,
+			Issuer:          details.Issuer,
+			EntityUUID:      &details.EntityUUID,
+			Duration:        details.Duration,
+		},
+	}
+	for _, usage := range details.Usages {
+		metadata.Usages = append(metadata.Usages, string(usage))
+	}
+	return metadata, nil
+}
+
+// generateRotatedKey generates a key of the same type as the current one. It is stored in the same
+// format and with the same passphrase as the existing key file once the new certificate is issued.
+func generateRotatedKey(ctx *cli.Context, privateKeyFile string, currentKey crypto.PublicKey) (crypto.Signer, cert.KeyOptions, error) {
+	var keyOptions cert.KeyOptions
+	if !cert.IsFileKey(privateKeyFile) {
+		return nil, keyOptions, fmt.Errorf("private key %s cannot be rotated, only key files can", privateKeyFile)
+	}
+
+	keyData, err := os.ReadFile(privateKeyFile)
+	if err != nil {
+		logrus.WithError(err).WithField("filename", privateKeyFile).Error("Failed to read private key")
+		return nil, keyOptions, err
+	}
+
+	keyOptions.Format = cert.PKCS8
+	if block, _ := pem.Decode(keyData); block != nil {
+		switch cert.PEMType(block.Type) {
+		case cert.RSAPrivateKey, cert.ECPrivateKey:
+			keyOptions.Format = cert.Traditional
+		case cert.EncryptedPrivateKey:
+			if keyOptions.Passphrase, err = getKeyPassphrase(ctx, false); err != nil {
+				return nil, keyOptions, err
+			}
+		}
+	}
+
+	keyOptions.Algorithm, keyOptions.Bits, err = cert.KeyAlgorithmOf(currentKey)
+	if err != nil {
+		return nil, keyOptions, err
+	}
+
+	logrus.WithField("algorithm", keyOptions.Algorithm).Info("Generating new private key")
+	privKey, err := cert.GenerateKey(keyOptions.Algorithm, keyOptions.Bits)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to generate key")
+		return nil, keyOptions, err
+	}
+	return privKey, keyOptions, nil
+}
+
+// writeTemporaryKey writes the PEM encoded key to a temporary file next to the key file it replaces.
+func writeTemporaryKey(data []byte, privateKeyFile string) (string, error) {
+	tmpFile, err := os.CreateTemp(filepath.Dir(privateKeyFile), "."+filepath.Base(privateKeyFile)+".new-*")
+	if err != nil {
+		logrus.WithError(err).WithField("filename", privateKeyFile).Error("Failed to create temporary private key file")
+		return "", err
+	}
+	tmpFile.Close()
+	if err := cert.ReplaceFile(data, tmpFile.Name(), 0600); err != nil {
+		os.Remove(tmpFile.Name())
+		return "", err
+	}
+	return tmpFile.Name(), nil
+}
+
+// renewalName replaces the timestamp suffix of a previous renewal with the current time.
+func renewalName(name string) string {
+	base := renewalSuffix.ReplaceAllString(name, "")
+	return fmt.Sprintf("%s-%s", base, time.Now().UTC().Format(renewalTimestampFormat))
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"github.com/xcnt/drivr-certificate-client/api"
+	"github.com/xcnt/drivr-certificate-client/bundle"
+	"github.com/xcnt/drivr-certificate-client/cert"
+)
+
+var (
+	requestOutfileFlag = &cli.StringFlag{
+		Name:  "request-outfile",
+		Usage: "Output file for the request bundle. Defaults to <name>.request.json",
+	}
+	requestInfileFlag = &cli.StringFlag{
+		Name:     "request-infile",
+		Usage:    "Request bundle created by request export",
+		Required: true,
+	}
+	responseOutfileFlag = &cli.StringFlag{
+		Name:  "response-outfile",
+		Usage: "Output file for the response bundle. Defaults to <name>.response.json",
+	}
+	responseInfileFlag = &cli.StringFlag{
+		Name:     "response-infile",
+		Usage:    "Response bundle created by request submit",
+		Required: true,
+	}
+)
+
+func requestCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "request",
+		Usage: "Exchange certificate requests with an offline machine",
+		Subcommands: []*cli.Command{
+			withWriteFlags(requestExportCommand()),
+			withWaitFlags(withWriteFlags(requestSubmitCommand())),
+			withWriteFlags(requestImportCommand()),
+		},
+	}
+}
+
+func requestExportCommand() *cli.Command {
+	return &cli.Command{
+		Name:   "export",
+		Usage:  "Create a signed request bundle without contacting DRIVR",
+		Before: checkSystemComponentCode,
+		Action: exportRequest,
+		Flags: []cli.Flag{
+			nameFlag,
+			privateKeyInfileFlag,
+			keyAlgorithmFlag,
+			keyBitsFlag,
+			encryptKeyFlag,
+			passphraseFileFlag,
+			pkcs11PINFileFlag,
+			systemCodeFlag,
+			componentCodeFlag,
+			issuerFlag,
+			certificateDurationFlag,
+			serverNameFlag,
+			commonNameFlag,
+			organizationFlag,
+			organizationalUnitFlag,
+			countryFlag,
+			localityFlag,
+			subjectSerialNumberFlag,
+			dnsNameFlag,
+			ipAddressFlag,
+			uriFlag,
+			requestOutfileFlag,
+		},
+	}
+}
+
+func requestSubmitCommand() *cli.Command {
+	return &cli.Command{
+		Name:   "submit",
+		Usage:  "Request the certificate of a request bundle from DRIVR and write a response bundle",
+		Before: checkAPIKey,
+		Action: submitRequest,
+		Flags: []cli.Flag{
+			requestInfileFlag,
+			responseOutfileFlag,
+			drivrAPIURLFlag,
+		},
+	}
+}
+
+func requestImportCommand() *cli.Command {
+	return &cli.Command{
+		Name:   "import",
+		Usage:  "Write the certificate of a response bundle after checking it matches the private key",
+		Action: importResponse,
+		Flags: []cli.Flag{
+			responseInfileFlag,
+			privateKeyInfileFlag,
+			passphraseFileFlag,
+			pkcs11PINFileFlag,
+			certificateOutfileFlag,
+		},
+	}
+}
+
+func exportRequest(ctx *cli.Context) error {
+	name := ctx.String(nameFlag.Name)
+
+	requestOutfile, err := requestOutfileFromFlags(ctx, requestOutfileFlag, name, "request.json")
+	if err != nil {
+		return err
+	}
+
+	csrData, err := csrDataFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+
+	privKey, keyCloser, err := openSignerFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+	defer keyCloser.Close()
+
+	csr, err := cert.CreateCSR(privKey, csrData)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to generate CSR")
+		return err
+	}
+
+	usages := []string{string(api.CertificateUsageClientAuth)}
+	if ctx.String(serverNameFlag.Name) != "" {
+		usages = append(usages, string(api.CertificateUsageServerAuth))
+	}
+
+	requestBundle, err := bundle.NewRequestBundle(privKey, bundle.Request{
+		Name:          name,
+		SystemCode:    ctx.String(systemCodeFlag.Name),
+		ComponentCode: ctx.String(componentCodeFlag.Name),
+		Issuer:        ctx.String(issuerFlag.Name),
+		Duration:      ctx.String(certificateDurationFlag.Name),
+		Usages:        usages,
+		CSR:           string(csr),
+		CreatedAt:     time.Now().UTC().Truncate(time.Second),
+	})
+	if err != nil {
+		return err
+	}
+
+	logrus.WithField("filename", requestOutfile).Debug("Writing request bundle")
+	return bundle.Write(requestBundle, requestOutfile, writeOptionsFromFlags(ctx))
+}
+
+// requestOutfileFromFlags returns the output file of the flag, defaulting to the certificate name of the bundle.
+// Bundles are exchanged with other hosts, so names which are not plain file names are rejected.
+func requestOutfileFromFlags(ctx *cli.Context, flag *cli.StringFlag, name, extension string) (string, error) {
+	if outfile := ctx.String(flag.Name); outfile != "" {
+		return outputPath(ctx, outfile), nil
+	}
+	return defaultOutfile(ctx, name, extension)
+}
+
+func submitRequest(ctx *cli.Context) error {
+	var requestBundle bundle.RequestBundle
+	if err := bundle.Load(ctx.String(requestInfileFlag.Name), &requestBundle); err != nil {
+		return err
+	}
+	if _, err := requestBundle.Verify(); err != nil {
+		logrus.WithError(err).Error("Invalid request bundle")
+		return err
+	}
+	request := requestBundle.Request
+
+	responseOutfile, err := requestOutfileFromFlags(ctx, responseOutfileFlag, request.Name, "response.json")
+	if err != nil {
+		return err
+	}
+
+	apiURL, err := url.Parse(getAPIUrl(ctx))
+	if err != nil {
+		logrus.WithError(err).Error("Failed to parse GraphQL API URL")
+		return err
+	}
+
+	drivrAPI, err := api.NewDrivrAPI(apiURL, getAPIKey())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to create DRIVR API client")
+		return err
+	}
+
+	certificate, certificateUUID, err := issueCertificate(ctx.Context, drivrAPI, &certificateRequest{
+		Name:          request.Name,
+		SystemCode:    request.SystemCode,
+		ComponentCode: request.ComponentCode,
+		Issuer:        request.Issuer,
+		Duration:      request.Duration,
+		ServerUse:     slices.Contains(request.Usages, string(api.CertificateUsageServerAuth)),
+		CSR:           []byte(request.CSR),
+	}, waitOptionsFromFlags(ctx))
+	if err != nil {
+		return err
+	}
+
+	logrus.WithField("filename", responseOutfile).Debug("Writing response bundle")
+	return bundle.Write(&bundle.ResponseBundle{
+		Version:         bundle.Version,
+		Name:            request.Name,
+		CertificateUUID: *certificateUUID,
+		Certificate:     string(cert.EncodePEM(cert.Certificate, certificate)),
+	}, responseOutfile, writeOptionsFromFlags(ctx))
+}
+
+func importResponse(ctx *cli.Context) error {
+	var responseBundle bundle.ResponseBundle
+	if err := bundle.Load(ctx.String(responseInfileFlag.Name), &responseBundle); err != nil {
+		return err
+	}
+	certificate, err := responseBundle.ParseCertificate()
+	if err != nil {
+		logrus.WithError(err).Error("Invalid response bundle")
+		return err
+	}
+
+	privateKeyFile := ctx.String(privateKeyInfileFlag.Name)
+	privKey, keyCloser, err := cert.OpenSigner(privateKeyFile, keyPassphraseFunc(ctx), pkcs11PINFunc(ctx))
+	if err != nil {
+		logrus.WithError(err).Error("Failed to load private key")
+		return err
+	}
+	defer keyCloser.Close()
+
+	if !cert.PublicKeysEqual(privKey.Public(), certificate.PublicKey) {
+		return errors.New("certificate does not match the private key")
+	}
+
+	certificateOutfile, err := requestOutfileFromFlags(ctx, certificateOutfileFlag, responseBundle.Name, "crt")
+	if err != nil {
+		return err
+	}
+	if ctx.String(certificateOutfileFlag.Name) == "" && cert.IsFileKey(privateKeyFile) && !ctx.IsSet(outDirFlag.Name) {
+		certificateOutfile = filepath.Join(filepath.Dir(privateKeyFile), certificateOutfile)
+	}
+
+	logrus.WithField("certificate_uuid", responseBundle.CertificateUUID).Debugf("Writing certificate to %s", certificateOutfile)
+	return cert.WriteToPEMFile(cert.Certificate, certificate.Raw, certificateOutfile, writeOptionsFromFlags(ctx))
+}
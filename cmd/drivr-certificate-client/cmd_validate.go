@@ -4,12 +4,14 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
+	"github.com/xcnt/drivr-certificate-client/cert"
 )
 
 var (
@@ -50,6 +52,8 @@ func validateCommand() *cli.Command {
 		Flags: []cli.Flag{
 			drivrAPIURLFlag,
 			privateKeyInfileFlag,
+			passphraseFileFlag,
+			pkcs11PINFileFlag,
 			certificateInfileFlag,
 			mqttBrokerFlag,
 			mqttBrokerPortFlag,
@@ -67,22 +71,37 @@ func loadCAFromFile(filename string) ([]byte, error) {
 	return ca, nil
 }
 
-func newTLSConfig(caCert []byte, clientCert, clientPrivateKey string) (*tls.Config, error) {
+func newTLSConfig(caCert []byte, clientKeyPair tls.Certificate) *tls.Config {
 	certpool := x509.NewCertPool()
 	certpool.AppendCertsFromPEM(caCert)
 
-	clientKeyPair, err := tls.LoadX509KeyPair(clientCert, clientPrivateKey)
-	if err != nil {
-		return nil, err
-	}
-
 	return &tls.Config{
 		RootCAs:            certpool,
 		ClientAuth:         tls.NoClientCert,
 		ClientCAs:          nil,
 		InsecureSkipVerify: true,
 		Certificates:       []tls.Certificate{clientKeyPair},
-	}, nil
+	}
+}
+
+// loadClientKeyPair loads the client certificate and the private key, which is either a key file
+// in any format supported by the cert package or a pkcs11: URI. The returned closer releases the key.
+func loadClientKeyPair(certificateFile, privateKey string, passphrase, pin cert.PassphraseFunc) (*tls.Certificate, io.Closer, error) {
+	certificate, err := cert.LoadCertificate(certificateFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privKey, keyCloser, err := cert.OpenSigner(privateKey, passphrase, pin)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{certificate.Raw},
+		PrivateKey:  privKey,
+		Leaf:        certificate,
+	}, keyCloser, nil
 }
 
 func validateCertificate(ctx *cli.Context) error {
@@ -126,11 +145,12 @@ func validateCertificate(ctx *cli.Context) error {
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(fmt.Sprintf("ssl://%s:%d", mqttBroker, mqttBrokerPort))
 
-	tlsConfig, err := newTLSConfig(cacert, certificateFile, privKeyFile)
+	clientKeyPair, keyCloser, err := loadClientKeyPair(certificateFile, privKeyFile, keyPassphraseFunc(ctx), pkcs11PINFunc(ctx))
 	if err != nil {
 		return err
 	}
-	opts.SetTLSConfig(tlsConfig)
+	defer keyCloser.Close()
+	opts.SetTLSConfig(newTLSConfig(cacert, *clientKeyPair))
 
 	client := mqtt.NewClient(opts)
 	if token := client.Connect(); token.Wait() && token.Error() != nil {
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"github.com/xcnt/drivr-certificate-client/cert"
+)
+
+var (
+	verifyCACertFlag = &cli.StringFlag{
+		Name:    "ca-cert",
+		Aliases: []string{"a"},
+		Usage:   "CA certificate file. If not set the CA of the issuer is fetched from DRIVR",
+	}
+	verifyPrivateKeyFlag = &cli.StringFlag{
+		Name:    "private-key-infile",
+		Aliases: []string{"p"},
+		Usage:   "Private key the certificate must match. If not set the key is not checked",
+	}
+	verifyUsageFlag = &cli.StringFlag{
+		Name:  "usage",
+		Usage: "Usage the certificate must allow. Either client or server",
+		Value: "client",
+	}
+	optionalDrivrAPIURLFlag = &cli.StringFlag{
+		Name:    drivrAPIURLFlag.Name,
+		Usage:   drivrAPIURLFlag.Usage,
+		EnvVars: drivrAPIURLFlag.EnvVars,
+	}
+)
+
+func verifyCommand() *cli.Command {
+	return &cli.Command{
+		Name:   "verify",
+		Usage:  "Verify a certificate against its issuer CA without connecting to a broker",
+		Action: verifyCertificate,
+		Flags: []cli.Flag{
+			certificateInfileFlag,
+			verifyPrivateKeyFlag,
+			passphraseFileFlag,
+			pkcs11PINFileFlag,
+			verifyCACertFlag,
+			issuerFlag,
+			optionalDrivrAPIURLFlag,
+			verifyUsageFlag,
+		},
+	}
+}
+
+func verifyCertificate(ctx *cli.Context) error {
+	certificateFile := ctx.String(certificateInfileFlag.Name)
+	if certificateFile == "" {
+		return fmt.Errorf("certificate file must be specified")
+	}
+
+	var usage x509.ExtKeyUsage
+	switch ctx.String(verifyUsageFlag.Name) {
+	case "client":
+		usage = x509.ExtKeyUsageClientAuth
+	case "server":
+		usage = x509.ExtKeyUsageServerAuth
+	default:
+		return fmt.Errorf("invalid usage %s", ctx.String(verifyUsageFlag.Name))
+	}
+
+	certificates, err := cert.LoadCertificateChain(certificateFile)
+	if err != nil {
+		return err
+	}
+	certificate := certificates[0]
+
+	roots, intermediates, err := loadVerifyPools(ctx, certificates[1:])
+	if err != nil {
+		return err
+	}
+
+	opts := cert.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		Usage:         usage,
+	}
+	if privateKeyFile := ctx.String(verifyPrivateKeyFlag.Name); privateKeyFile != "" {
+		privKey, keyCloser, err := cert.OpenSigner(privateKeyFile, keyPassphraseFunc(ctx), pkcs11PINFunc(ctx))
+		if err != nil {
+			logrus.WithError(err).Error("Failed to load private key")
+			return err
+		}
+		defer keyCloser.Close()
+		opts.PrivateKey = privKey
+	}
+
+	results, err := cert.Verify(certificate, opts)
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("FAIL  %-12s %v\n", result.Check, result.Err)
+		} else {
+			fmt.Printf("OK    %s\n", result.Check)
+		}
+	}
+	return err
+}
+
+// loadVerifyPools returns the trust roots and the intermediate CAs. Only self-signed certificates of the
+// CA file are trusted, its other certificates are intermediates like the chain of the certificate file.
+// The issuer CA fetched from DRIVR is always trusted.
+func loadVerifyPools(ctx *cli.Context, chain []*x509.Certificate) (*x509.CertPool, *x509.CertPool, error) {
+	caCertificates, err := loadCACertificates(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roots := x509.NewCertPool()
+	intermediates := x509.NewCertPool()
+	for _, caCertificate := range caCertificates {
+		if ctx.String(verifyCACertFlag.Name) == "" || cert.IsSelfSigned(caCertificate) {
+			roots.AddCert(caCertificate)
+		} else {
+			intermediates.AddCert(caCertificate)
+		}
+	}
+	for _, chainCertificate := range chain {
+		intermediates.AddCert(chainCertificate)
+	}
+	return roots, intermediates, nil
+}
+
+// loadCACertificates reads the CA certificates from the CA file or fetches the issuer CA from DRIVR.
+func loadCACertificates(ctx *cli.Context) ([]*x509.Certificate, error) {
+	var caCertificates []*x509.Certificate
+
+	if caFile := ctx.String(verifyCACertFlag.Name); caFile != "" {
+		caBytes, err := os.ReadFile(caFile)
+		if err != nil {
+			logrus.WithError(err).WithField("filename", caFile).Error("Failed to read CA certificate")
+			return nil, err
+		}
+		caCertificates, err = cert.ParseCertificates(caBytes)
+		if err != nil {
+			logrus.WithError(err).WithField("filename", caFile).Error("Failed to parse CA certificate")
+			return nil, err
+		}
+	} else {
+		if ctx.String(optionalDrivrAPIURLFlag.Name) == "" {
+			return nil, fmt.Errorf("either %s or %s must be specified", verifyCACertFlag.Name, optionalDrivrAPIURLFlag.Name)
+		}
+		if err := checkAPIKey(ctx); err != nil {
+			return nil, err
+		}
+		apiURL, err := url.Parse(getAPIUrl(ctx))
+		if err != nil {
+			logrus.WithError(err).Error("Failed to parse GraphQL API URL")
+			return nil, err
+		}
+		ca, err := getCaCert(ctx.Context, ctx.String(issuerFlag.Name), apiURL, getAPIKey())
+		if err != nil {
+			return nil, err
+		}
+		caCertificate, err := x509.ParseCertificate(ca)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to parse CA certificate")
+			return nil, err
+		}
+		caCertificates = append(caCertificates, caCertificate)
+	}
+
+	if len(caCertificates) == 0 {
+		return nil, errors.New("no CA certificate found")
+	}
+	return caCertificates, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"github.com/xcnt/drivr-certificate-client/cert"
+)
+
+// hookPolicy decides what happens if a hook fails.
+type hookPolicy string
+
+const (
+	// hookPolicyAbort stops at the first failing hook and fails the command.
+	hookPolicyAbort hookPolicy = "abort"
+	// hookPolicyWarn logs failing hooks and runs the remaining ones.
+	hookPolicyWarn hookPolicy = "warn"
+	// hookPolicyRollback stops at the first failing hook, restores the previous files and fails the command.
+	hookPolicyRollback hookPolicy = "rollback"
+)
+
+var (
+	hookFlag = &cli.StringSliceFlag{
+		Name:  "hook",
+		Usage: "Command run with /bin/sh after the certificate has been written, e.g. 'systemctl reload mosquitto'. Can be given multiple times",
+	}
+	hookPolicyFlag = &cli.StringFlag{
+		Name:  "hook-policy",
+		Value: string(hookPolicyAbort),
+		Usage: "What to do if a hook fails: abort, warn or rollback to the previous files",
+	}
+	hookTimeoutFlag = &cli.DurationFlag{
+		Name:  "hook-timeout",
+		Value: time.Minute,
+		Usage: "Time after which a hook is killed",
+	}
+
+	hookFlags = []cli.Flag{hookFlag, hookPolicyFlag, hookTimeoutFlag}
+)
+
+// hookEvent describes a written certificate to the hooks.
+type hookEvent struct {
+	// Event is the command which wrote the certificate: create, fetch or renew.
+	Event           string
+	CertificateFile string
+	PrivateKeyFile  string
+	CertificateUUID *uuid.UUID
+	Name            string
+	EntityUUID      *uuid.UUID
+	EntityType      string
+	SystemCode      string
+	ComponentCode   string
+	// Certificate is the DER encoded certificate.
+	Certificate []byte
+}
+
+// environment returns the environment variables passed to the hooks. Unknown values are omitted.
+func (e hookEvent) environment() []string {
+	var env []string
+	add := func(name, value string) {
+		if value != "" {
+			env = append(env, name+"="+value)
+		}
+	}
+
+	add("DRIVR_HOOK_EVENT", e.Event)
+	add("DRIVR_CERTIFICATE_FILE", absolutePath(e.CertificateFile))
+	if cert.IsFileKey(e.PrivateKeyFile) {
+		add("DRIVR_PRIVATE_KEY_FILE", absolutePath(e.PrivateKeyFile))
+	} else {
+		add("DRIVR_PRIVATE_KEY_FILE", e.PrivateKeyFile)
+	}
+	if e.CertificateUUID != nil {
+		add("DRIVR_CERTIFICATE_UUID", e.CertificateUUID.String())
+	}
+	add("DRIVR_CERTIFICATE_NAME", e.Name)
+	if e.EntityUUID != nil {
+		add("DRIVR_ENTITY_UUID", e.EntityUUID.String())
+	}
+	add("DRIVR_ENTITY_TYPE", e.EntityType)
+	add("DRIVR_SYSTEM_CODE", e.SystemCode)
+	add("DRIVR_COMPONENT_CODE", e.ComponentCode)
+
+	if certificate, err := x509.ParseCertificate(e.Certificate); err == nil {
+		add("DRIVR_CERTIFICATE_SERIAL", certificate.SerialNumber.Text(16))
+		add("DRIVR_CERTIFICATE_NOT_BEFORE", certificate.NotBefore.UTC().Format(time.RFC3339))
+		add("DRIVR_CERTIFICATE_NOT_AFTER", certificate.NotAfter.UTC().Format(time.RFC3339))
+		add("DRIVR_CERTIFICATE_FINGERPRINT", cert.Fingerprint(certificate.Raw))
+	}
+	return env
+}
+
+func absolutePath(filename string) string {
+	if filename == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(filename); err == nil {
+		return abs
+	}
+	return filename
+}
+
+// hookRunner runs the configured hooks after a certificate has been written.
+type hookRunner struct {
+	commands []string
+	policy   hookPolicy
+	timeout  time.Duration
+}
+
+func hookRunnerFromFlags(ctx *cli.Context) (*hookRunner, error) {
+	runner := &hookRunner{
+		commands: ctx.StringSlice(hookFlag.Name),
+		policy:   hookPolicy(ctx.String(hookPolicyFlag.Name)),
+		timeout:  ctx.Duration(hookTimeoutFlag.Name),
+	}
+	switch runner.policy {
+	case hookPolicyAbort, hookPolicyWarn, hookPolicyRollback:
+	default:
+		return nil, fmt.Errorf("invalid hook policy %s, must be one of abort, warn or rollback", runner.policy)
+	}
+	return runner, nil
+}
+
+// snapshot keeps the current contents of the files if they are restored when a hook fails.
+func (r *hookRunner) snapshot(filenames ...string) (*cert.FileSnapshot, error) {
+	if r == nil || len(r.commands) == 0 || r.policy != hookPolicyRollback {
+		return nil, nil
+	}
+	return cert.SnapshotFiles(filenames...)
+}
+
+// run runs all hooks in order and applies the failure policy. The snapshot is restored on rollback.
+func (r *hookRunner) run(ctx context.Context, event hookEvent, snapshot *cert.FileSnapshot) error {
+	if r == nil {
+		return nil
+	}
+
+	env := append(os.Environ(), event.environment()...)
+	for _, command := range r.commands {
+		log := logrus.WithField("hook", command)
+		log.Debug("Running hook")
+		err := r.runCommand(ctx, command, env)
+		if err == nil {
+			continue
+		}
+
+		switch r.policy {
+		case hookPolicyWarn:
+			log.WithError(err).Warn("Hook failed")
+			continue
+		case hookPolicyRollback:
+			log.WithError(err).Error("Hook failed, restoring previous files")
+			if snapshot != nil {
+				if restoreErr := snapshot.Restore(); restoreErr != nil {
+					return errors.Join(fmt.Errorf("hook %q failed: %w", command, err), restoreErr)
+				}
+			}
+		default:
+			log.WithError(err).Error("Hook failed")
+		}
+		return fmt.Errorf("hook %q failed: %w", command, err)
+	}
+	return nil
+}
+
+func (r *hookRunner) runCommand(ctx context.Context, command string, env []string) error {
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Env = env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.WaitDelay = 5 * time.Second
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("timed out after %s", r.timeout)
+		}
+		return err
+	}
+	return nil
+}
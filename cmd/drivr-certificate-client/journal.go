@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"github.com/xcnt/drivr-certificate-client/api"
+	"github.com/xcnt/drivr-certificate-client/bundle"
+	"github.com/xcnt/drivr-certificate-client/cert"
+)
+
+var journalDirFlag = &cli.StringFlag{
+	Name:    "journal-dir",
+	Usage:   "Directory recording unfinished certificate requests, see the pending command",
+	Value:   defaultJournalDir(),
+	EnvVars: []string{"DRIVR_JOURNAL_DIR"},
+}
+
+// defaultJournalDir returns the journal directory below the user's state directory.
+func defaultJournalDir() string {
+	const subdir = "drivr-certificate-client/journal"
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, filepath.FromSlash(subdir))
+	}
+	if runtime.GOOS != "windows" {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, ".local", "state", filepath.FromSlash(subdir))
+		}
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(dir, filepath.FromSlash(subdir))
+	}
+	return filepath.Join(os.TempDir(), filepath.FromSlash(subdir))
+}
+
+func journalFromFlags(ctx *cli.Context) bundle.Journal {
+	return bundle.Journal{Dir: ctx.String(journalDirFlag.Name)}
+}
+
+// saveJournal records the entry. Failures are only logged, the journal is not required to issue a certificate.
+func saveJournal(journal bundle.Journal, entry *bundle.JournalEntry) {
+	if err := journal.Save(entry); err != nil {
+		logrus.WithError(err).WithField("journal_dir", journal.Dir).Warn("Failed to record certificate request in journal")
+	}
+}
+
+func removeJournal(journal bundle.Journal, entry *bundle.JournalEntry) {
+	if err := journal.Remove(entry.ID); err != nil {
+		logrus.WithError(err).WithField("journal_id", entry.ID).Warn("Failed to remove finished certificate request from journal")
+	}
+}
+
+// newJournalEntry prepares the journal entry of a certificate request written to certificateFile.
+func newJournalEntry(request *certificateRequest, privateKeyFile, certificateFile string, format cert.OutputFormat, writeMetadata bool) *bundle.JournalEntry {
+	if cert.IsFileKey(privateKeyFile) {
+		privateKeyFile = absolutePath(privateKeyFile)
+	}
+	return &bundle.JournalEntry{
+		ID:              bundle.JournalID(certificateFile),
+		Step:            bundle.JournalPrepared,
+		Name:            request.Name,
+		SystemCode:      request.SystemCode,
+		ComponentCode:   request.ComponentCode,
+		Issuer:          request.Issuer,
+		Duration:        request.Duration,
+		ServerUse:       request.ServerUse,
+		CSR:             string(request.CSR),
+		PrivateKey:      privateKeyFile,
+		CertificateFile: absolutePath(certificateFile),
+		OutputFormat:    string(format),
+		WriteMetadata:   writeMetadata,
+	}
+}
+
+// journalRequested records that the certificate of the entry has been requested.
+func journalRequested(journal bundle.Journal, entry *bundle.JournalEntry, request *certificateRequest, certificateUUID *uuid.UUID) {
+	entry.Step = bundle.JournalRequested
+	entry.EntityUUID = request.EntityUUID
+	entry.IssuerUUID = request.IssuerUUID
+	entry.CertificateUUID = certificateUUID
+	saveJournal(journal, entry)
+}
+
+// journalRequest returns the certificate request recorded in the entry.
+func journalRequest(entry *bundle.JournalEntry) *certificateRequest {
+	return &certificateRequest{
+		Name:          entry.Name,
+		SystemCode:    entry.SystemCode,
+		ComponentCode: entry.ComponentCode,
+		EntityUUID:    entry.EntityUUID,
+		Issuer:        entry.Issuer,
+		IssuerUUID:    entry.IssuerUUID,
+		Duration:      entry.Duration,
+		ServerUse:     entry.ServerUse,
+		CSR:           []byte(entry.CSR),
+	}
+}
+
+// resumableJournalEntry returns the journal entry of an earlier run which requested the same certificate
+// with the same key for certificateFile, or nil if the certificate has to be requested.
+func resumableJournalEntry(journal bundle.Journal, certificateFile string, request *certificateRequest) *bundle.JournalEntry {
+	entry, err := journal.Load(bundle.JournalID(certificateFile))
+	if err != nil {
+		logrus.WithError(err).WithField("journal_dir", journal.Dir).Warn("Failed to read journal")
+		return nil
+	}
+	if entry == nil || entry.Step != bundle.JournalRequested || entry.CertificateUUID == nil {
+		return nil
+	}
+
+	if entry.Name != request.Name || entry.SystemCode != request.SystemCode || entry.ComponentCode != request.ComponentCode ||
+		entry.Issuer != request.Issuer || !sameCSRKey(entry.CSR, request.CSR) {
+		logrus.WithField("journal_id", entry.ID).Warn("Replacing journal entry of a different request for the same certificate file")
+		return nil
+	}
+	return entry
+}
+
+func sameCSRKey(a string, b []byte) bool {
+	csrA, err := cert.ParseCSR([]byte(a))
+	if err != nil {
+		return false
+	}
+	csrB, err := cert.ParseCSR(b)
+	if err != nil {
+		return false
+	}
+	return cert.PublicKeysEqual(csrA.PublicKey, csrB.PublicKey)
+}
+
+// isPermanentRequestError reports whether DRIVR certainly did not create the certificate and the request
+// would fail again, so there is nothing to resume.
+func isPermanentRequestError(err error) bool {
+	return errors.Is(err, api.ErrNotFound) || errors.Is(err, api.ErrValidation) ||
+		errors.Is(err, api.ErrUnauthorized) || errors.Is(err, api.ErrForbidden)
+}
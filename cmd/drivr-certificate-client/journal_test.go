@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/xcnt/drivr-certificate-client/api"
+	"github.com/xcnt/drivr-certificate-client/bundle"
+	"github.com/xcnt/drivr-certificate-client/cert"
+)
+
+func newTestKey(t *testing.T) crypto.Signer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newTestCSR(t *testing.T, key crypto.Signer, commonName string) []byte {
+	t.Helper()
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: commonName}}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.EncodePEM(cert.CertificateRequest, der)
+}
+
+func TestResumableJournalEntry(t *testing.T) {
+	key := newTestKey(t)
+	csr := newTestCSR(t, key, "gateway")
+	otherKeyCSR := newTestCSR(t, newTestKey(t), "gateway")
+	certificateUUID := uuid.New()
+
+	request := func() *certificateRequest {
+		return &certificateRequest{Name: "gw", SystemCode: "sys1", Issuer: "default", Duration: "P365D", CSR: csr}
+	}
+
+	tests := []struct {
+		name string
+		// entry modifies the journal entry of request(), nil records no entry
+		entry func(*bundle.JournalEntry)
+		// request modifies the certificate request of the current run
+		request       func(*certificateRequest)
+		otherFile     bool
+		wantResumable bool
+	}{
+		{name: "no entry"},
+		{name: "same request", entry: func(*bundle.JournalEntry) {}, wantResumable: true},
+		{name: "same key with a new CSR", entry: func(*bundle.JournalEntry) {}, request: func(r *certificateRequest) {
+			r.CSR = newTestCSR(t, key, "renamed")
+		}, wantResumable: true},
+		{name: "different duration", entry: func(*bundle.JournalEntry) {}, request: func(r *certificateRequest) {
+			r.Duration = "P30D"
+		}, wantResumable: true},
+		{name: "not requested yet", entry: func(e *bundle.JournalEntry) { e.Step = bundle.JournalPrepared }},
+		{name: "requested without certificate UUID", entry: func(e *bundle.JournalEntry) { e.CertificateUUID = nil }},
+		{name: "different name", entry: func(*bundle.JournalEntry) {}, request: func(r *certificateRequest) { r.Name = "gw2" }},
+		{name: "different system", entry: func(*bundle.JournalEntry) {}, request: func(r *certificateRequest) { r.SystemCode = "sys2" }},
+		{name: "component instead of system", entry: func(*bundle.JournalEntry) {}, request: func(r *certificateRequest) {
+			r.SystemCode = ""
+			r.ComponentCode = "sys1"
+		}},
+		{name: "different issuer", entry: func(*bundle.JournalEntry) {}, request: func(r *certificateRequest) { r.Issuer = "other" }},
+		{name: "different key", entry: func(*bundle.JournalEntry) {}, request: func(r *certificateRequest) { r.CSR = otherKeyCSR }},
+		{name: "invalid recorded CSR", entry: func(e *bundle.JournalEntry) { e.CSR = "invalid" }},
+		{name: "other certificate file", entry: func(*bundle.JournalEntry) {}, otherFile: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			journal := bundle.Journal{Dir: filepath.Join(dir, "journal")}
+			certificateFile := filepath.Join(dir, "gw.crt")
+
+			if tt.entry != nil {
+				entry := newJournalEntry(request(), filepath.Join(dir, "private.key"), certificateFile, cert.Leaf, false)
+				entry.Step = bundle.JournalRequested
+				entry.CertificateUUID = &certificateUUID
+				tt.entry(entry)
+				if err := journal.Save(entry); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			current := request()
+			if tt.request != nil {
+				tt.request(current)
+			}
+			if tt.otherFile {
+				certificateFile = filepath.Join(dir, "other.crt")
+			}
+
+			entry := resumableJournalEntry(journal, certificateFile, current)
+			if !tt.wantResumable {
+				if entry != nil {
+					t.Errorf("expected no resumable entry, got %+v", entry)
+				}
+				return
+			}
+			if entry == nil {
+				t.Fatal("expected a resumable entry")
+			}
+			if entry.CertificateUUID == nil || *entry.CertificateUUID != certificateUUID {
+				t.Errorf("got certificate UUID %v, want %s", entry.CertificateUUID, certificateUUID)
+			}
+		})
+	}
+}
+
+func TestResumableJournalEntryUnreadableJournal(t *testing.T) {
+	dir := t.TempDir()
+	certificateFile := filepath.Join(dir, "gw.crt")
+	journal := bundle.Journal{Dir: dir}
+	if err := os.WriteFile(filepath.Join(dir, bundle.JournalID(certificateFile)+".json"), []byte(`{"version": 99}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	request := &certificateRequest{Name: "gw", CSR: newTestCSR(t, newTestKey(t), "gateway")}
+	if entry := resumableJournalEntry(journal, certificateFile, request); entry != nil {
+		t.Errorf("expected no resumable entry, got %+v", entry)
+	}
+}
+
+func TestSameCSRKey(t *testing.T) {
+	key := newTestKey(t)
+	csr := newTestCSR(t, key, "a")
+
+	tests := []struct {
+		name string
+		a    string
+		b    []byte
+		want bool
+	}{
+		{name: "same CSR", a: string(csr), b: csr, want: true},
+		{name: "same key", a: string(csr), b: newTestCSR(t, key, "b"), want: true},
+		{name: "different key", a: string(csr), b: newTestCSR(t, newTestKey(t), "a")},
+		{name: "invalid first CSR", a: "invalid", b: csr},
+		{name: "invalid second CSR", a: string(csr), b: []byte("invalid")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameCSRKey(tt.a, tt.b); got != tt.want {
+				t.Errorf("sameCSRKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPermanentRequestError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "not found", err: &api.NotFoundError{Kind: "system", Key: "sys1"}, want: true},
+		{name: "validation", err: &api.ValidationError{Message: "Invalid input"}, want: true},
+		{name: "unauthorized", err: fmt.Errorf("%w: token expired", api.ErrUnauthorized), want: true},
+		{name: "forbidden", err: fmt.Errorf("%w: missing permission", api.ErrForbidden), want: true},
+		{name: "transport", err: &api.TransportError{Err: errors.New("connection reset")}},
+		{name: "gateway timeout", err: &api.TransportError{StatusCode: 504, Err: errors.New("timeout")}},
+		{name: "interrupted", err: fmt.Errorf("Post: %w", context.Canceled)},
+		{name: "timeout", err: context.DeadlineExceeded},
+		{name: "unknown", err: errors.New("internal server error")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isPermanentRequestError(tt.err); got != tt.want {
+				t.Errorf("isPermanentRequestError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/urfave/cli/v2"
+	"github.com/xcnt/drivr-certificate-client/api"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -16,8 +22,59 @@ var (
 		Value:   "INFO",
 		EnvVars: []string{"DRIVR_LOG_LEVEL"},
 	}
+	apiTimeoutFlag = &cli.DurationFlag{
+		Name:    "api-timeout",
+		Usage:   "Maximum duration of a DRIVR API call including all retries, 0 disables the limit",
+		Value:   api.DefaultTransportOptions.Timeout,
+		EnvVars: []string{"DRIVR_API_TIMEOUT"},
+	}
+	apiRequestTimeoutFlag = &cli.DurationFlag{
+		Name:    "api-request-timeout",
+		Usage:   "Maximum duration of a single HTTP request to DRIVR, 0 disables the limit",
+		Value:   api.DefaultTransportOptions.RequestTimeout,
+		EnvVars: []string{"DRIVR_API_REQUEST_TIMEOUT"},
+	}
+	apiRetriesFlag = &cli.IntFlag{
+		Name:    "api-retries",
+		Usage:   "Number of retries of failed DRIVR API requests. Certificates are only requested again if DRIVR has certainly not received the request",
+		Value:   api.DefaultTransportOptions.MaxRetries,
+		EnvVars: []string{"DRIVR_API_RETRIES"},
+	}
 )
 
+// Exit codes of failed commands, so scripts can tell the errors returned by DRIVR apart.
+const (
+	exitFailure      = 1
+	exitNotFound     = 3
+	exitValidation   = 4
+	exitUnauthorized = 5
+	exitForbidden    = 6
+	exitTransport    = 7
+	exitNotYetSigned = 8
+	exitInterrupted  = 130
+)
+
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.Is(err, api.ErrUnauthorized):
+		return exitUnauthorized
+	case errors.Is(err, api.ErrForbidden):
+		return exitForbidden
+	case errors.Is(err, api.ErrValidation):
+		return exitValidation
+	case errors.Is(err, api.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, api.ErrNotYetSigned):
+		return exitNotYetSigned
+	case errors.Is(err, api.ErrTransport):
+		return exitTransport
+	default:
+		return exitFailure
+	}
+}
+
 func initLogging(ctx *cli.Context) {
 	log.SetOutput(os.Stderr)
 	level, err := log.ParseLevel(ctx.String(logLevelFlag.Name))
@@ -28,6 +85,18 @@ func initLogging(ctx *cli.Context) {
 	log.SetLevel(level)
 }
 
+func initTransport(ctx *cli.Context) error {
+	options := api.DefaultTransportOptions
+	options.Timeout = ctx.Duration(apiTimeoutFlag.Name)
+	options.RequestTimeout = ctx.Duration(apiRequestTimeoutFlag.Name)
+	options.MaxRetries = ctx.Int(apiRetriesFlag.Name)
+	if options.Timeout < 0 || options.RequestTimeout < 0 || options.MaxRetries < 0 {
+		return fmt.Errorf("%s, %s and %s must not be negative", apiTimeoutFlag.Name, apiRequestTimeoutFlag.Name, apiRetriesFlag.Name)
+	}
+	api.SetTransportOptions(options)
+	return nil
+}
+
 func main() {
 	app := &cli.App{
 		EnableBashCompletion: true,
@@ -35,10 +104,13 @@ func main() {
 		Description:          "drivr-certificate-client is a command line tool for creating certificates",
 		Flags: []cli.Flag{
 			logLevelFlag,
+			apiTimeoutFlag,
+			apiRequestTimeoutFlag,
+			apiRetriesFlag,
 		},
 		Before: func(ctx *cli.Context) error {
 			initLogging(ctx)
-			return nil
+			return initTransport(ctx)
 		},
 		Commands: []*cli.Command{
 			createCommand(),
@@ -46,11 +118,27 @@ func main() {
 			completionCommand(),
 			dumpCommand(),
 			validateCommand(),
+			requestCommand(),
+			inspectCommand(),
+			verifyCommand(),
+			exportCommand(),
+			renewCommand(),
+			agentCommand(),
+			provisionCommand(),
+			pendingCommand(),
 		},
 		Version: version,
 	}
 
-	if err := app.Run(os.Args); err != nil {
-		log.Fatalln(err)
+	// SIGINT and SIGTERM cancel the running command, which exits with code 130. A second signal terminates immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if err := app.RunContext(ctx, os.Args); err != nil {
+		log.StandardLogger().Logln(log.FatalLevel, err)
+		os.Exit(exitCode(err))
 	}
 }
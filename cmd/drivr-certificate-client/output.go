@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"github.com/xcnt/drivr-certificate-client/api"
+	"github.com/xcnt/drivr-certificate-client/cert"
+)
+
+var (
+	outputFormatFlag = &cli.StringFlag{
+		Name:  "output-format",
+		Usage: "Format of the certificate output file. One of leaf, fullchain (leaf and issuer CA), combined (leaf and private key), der, pkcs12, k8s-secret or k8s-secret-json",
+		Value: string(cert.Leaf),
+	}
+	k8sSecretNameFlag = &cli.StringFlag{
+		Name:  "k8s-name",
+		Usage: "Name of the Kubernetes secret. Defaults to the certificate name",
+	}
+	k8sNamespaceFlag = &cli.StringFlag{
+		Name:  "k8s-namespace",
+		Usage: "Namespace of the Kubernetes secret",
+	}
+	k8sLabelFlag = &cli.StringSliceFlag{
+		Name:  "k8s-label",
+		Usage: "Additional label of the Kubernetes secret as key=value. Can be given multiple times",
+	}
+	k8sIncludeCAFlag = &cli.BoolFlag{
+		Name:  "k8s-include-ca",
+		Usage: "Add the issuer CA as ca.crt to the Kubernetes secret",
+	}
+	outputFlags = []cli.Flag{
+		outputFormatFlag,
+		exportPasswordFileFlag,
+		k8sSecretNameFlag,
+		k8sNamespaceFlag,
+		k8sLabelFlag,
+		k8sIncludeCAFlag,
+	}
+)
+
+// outputFormatFromFlags returns the output format and checks that the private key
+// can be embedded if the format requires it.
+func outputFormatFromFlags(ctx *cli.Context, privateKeyFile string) (cert.OutputFormat, error) {
+	format, err := cert.ParseOutputFormat(ctx.String(outputFormatFlag.Name))
+	if err != nil {
+		return "", err
+	}
+	if format.NeedsPrivateKey() && (privateKeyFile == "" || !cert.IsFileKey(privateKeyFile)) {
+		return "", fmt.Errorf("%s output requires a private key file", format)
+	}
+	return format, nil
+}
+
+// certificateOutfileFromFlags returns the certificate output file, defaulting to the certificate name.
+func certificateOutfileFromFlags(ctx *cli.Context, name string, format cert.OutputFormat) (string, error) {
+	if certificateOutfile := ctx.String(certificateOutfileFlag.Name); certificateOutfile != "" {
+		return outputPath(ctx, certificateOutfile), nil
+	}
+	return defaultOutfile(ctx, name, format.Extension())
+}
+
+// writeCertificateOutput writes the certificate in the given format. The issuer CA is fetched
+// and the private key is read only if the format includes them.
+func writeCertificateOutput(ctx *cli.Context, drivrAPI *api.DrivrAPI, format cert.OutputFormat, certificateUUID *uuid.UUID, certificate []byte, name, privateKeyFile, filename string, opts cert.WriteOptions) error {
+	bundle := cert.CertificateBundle{Certificate: certificate, Name: name}
+
+	if format.NeedsCA() || format.IsKubernetesSecret() {
+		ca, issuer, err := drivrAPI.FetchCertificateIssuerCA(ctx.Context, certificateUUID)
+		if err != nil {
+			return err
+		}
+		if format.NeedsCA() || ctx.Bool(k8sIncludeCAFlag.Name) {
+			bundle.CA = ca
+		}
+		bundle.Kubernetes.Issuer = issuer
+	}
+
+	switch format {
+	case cert.Combined:
+		privateKey, err := readPrivateKeyPEM(privateKeyFile)
+		if err != nil {
+			return err
+		}
+		bundle.PrivateKey = privateKey
+	case cert.PKCS12:
+		signer, err := cert.LoadPrivateKey(privateKeyFile, keyPassphraseFunc(ctx))
+		if err != nil {
+			logrus.WithError(err).WithField("filename", privateKeyFile).Error("Failed to load private key")
+			return err
+		}
+		password, err := getExportPassword(ctx)
+		if err != nil {
+			return err
+		}
+		bundle.Signer = signer
+		bundle.Password = password
+	case cert.KubernetesSecret, cert.KubernetesSecretJSON:
+		privateKey, err := readUnencryptedPrivateKeyPEM(ctx, privateKeyFile)
+		if err != nil {
+			return err
+		}
+		labels, err := parseLabels(ctx.StringSlice(k8sLabelFlag.Name))
+		if err != nil {
+			return err
+		}
+		bundle.PrivateKey = privateKey
+		bundle.Kubernetes.Name = ctx.String(k8sSecretNameFlag.Name)
+		bundle.Kubernetes.Namespace = ctx.String(k8sNamespaceFlag.Name)
+		bundle.Kubernetes.Labels = labels
+		bundle.Kubernetes.CertificateUUID = certificateUUID.String()
+	}
+
+	logrus.WithField("format", format).Debugf("Writing certificate to %s", filename)
+	if err := cert.WriteCertificate(format, bundle, filename, opts); err != nil {
+		logrus.WithField("filename", filename).WithError(err).Error("Failed to write certificate to file")
+		return err
+	}
+	return nil
+}
+
+func readPrivateKeyPEM(filename string) ([]byte, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		logrus.WithError(err).WithField("filename", filename).Error("Failed to read private key")
+		return nil, err
+	}
+	if block, _ := pem.Decode(data); block == nil || !cert.PEMType(block.Type).IsSecret() {
+		return nil, fmt.Errorf("private key %s is not PEM encoded", filename)
+	}
+	return data, nil
+}
+
+// readUnencryptedPrivateKeyPEM reads the private key and returns it PEM encoded without encryption.
+func readUnencryptedPrivateKeyPEM(ctx *cli.Context, filename string) ([]byte, error) {
+	privKey, err := cert.LoadPrivateKey(filename, keyPassphraseFunc(ctx))
+	if err != nil {
+		logrus.WithError(err).WithField("filename", filename).Error("Failed to load private key")
+		return nil, err
+	}
+	keyType, keyBytes, err := cert.MarshalPrivateKey(privKey, cert.PKCS8)
+	if err != nil {
+		return nil, err
+	}
+	return cert.EncodePEM(keyType, keyBytes), nil
+}
+
+// parseLabels parses key=value pairs.
+func parseLabels(values []string) (map[string]string, error) {
+	labels := make(map[string]string, len(values))
+	for _, value := range values {
+		key, labelValue, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label %s, expected key=value", value)
+		}
+		labels[key] = labelValue
+	}
+	return labels, nil
+}
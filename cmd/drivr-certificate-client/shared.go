@@ -1,14 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
 
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
+	"github.com/xcnt/drivr-certificate-client/cert"
 	"golang.org/x/term"
 )
 
@@ -45,9 +49,41 @@ var (
 		Aliases: []string{"i"},
 		Usage:   "Issuer of the certificate",
 	}
+
+	encryptKeyFlag = &cli.BoolFlag{
+		Name:  "encrypt-key",
+		Usage: "Encrypt the generated private key with a passphrase (PKCS#8)",
+	}
+	passphraseFileFlag = &cli.StringFlag{
+		Name:  "passphrase-file",
+		Usage: "File containing the passphrase of the private key. If not set the passphrase is read from " + keyPassphraseEnv + " or prompted for",
+	}
+	pkcs11PINFileFlag = &cli.StringFlag{
+		Name:  "pkcs11-pin-file",
+		Usage: "File containing the PIN of a pkcs11: private key URI without pin-value or pin-source. If not set the PIN is read from " + pkcs11PINEnv + " or prompted for",
+	}
+	forceFlag = &cli.BoolFlag{
+		Name:  "force",
+		Usage: "Overwrite existing output files",
+	}
+	backupFlag = &cli.BoolFlag{
+		Name:  "backup",
+		Usage: "Keep a timestamped copy of overwritten output files. Implies --force",
+	}
+	outDirFlag = &cli.StringFlag{
+		Name:  "out-dir",
+		Usage: "Directory relative output files are written to",
+	}
+	exportPasswordFileFlag = &cli.StringFlag{
+		Name:  "export-password-file",
+		Usage: "File containing the password of exported key stores. If not set the password is read from " + exportPasswordEnv + " or prompted for",
+	}
 )
 
 const drivrAPIKeyEnv = "DRIVR_API_KEY"
+const keyPassphraseEnv = "DRIVR_KEY_PASSPHRASE"
+const exportPasswordEnv = "DRIVR_EXPORT_PASSWORD"
+const pkcs11PINEnv = "DRIVR_PKCS11_PIN"
 
 var apikey string
 
@@ -72,6 +108,172 @@ func getAPIKey() string {
 	return apikey
 }
 
+var (
+	keyPassphrase   []byte
+	keyPassphraseMu sync.Mutex
+)
+
+// getKeyPassphrase reads the private key passphrase from the passphrase file, the environment or the terminal.
+// If confirm is set a prompted passphrase has to be entered twice.
+func getKeyPassphrase(ctx *cli.Context, confirm bool) ([]byte, error) {
+	keyPassphraseMu.Lock()
+	defer keyPassphraseMu.Unlock()
+	if keyPassphrase != nil {
+		return keyPassphrase, nil
+	}
+
+	passphrase, err := readSecret(ctx.String(passphraseFileFlag.Name), keyPassphraseEnv, "private key passphrase", confirm)
+	if err != nil {
+		return nil, err
+	}
+	keyPassphrase = passphrase
+	return keyPassphrase, nil
+}
+
+var (
+	pkcs11PIN   []byte
+	pkcs11PINMu sync.Mutex
+)
+
+// getPKCS11PIN reads the PIN of a PKCS#11 token from the PIN file, the environment or the terminal.
+func getPKCS11PIN(ctx *cli.Context) ([]byte, error) {
+	pkcs11PINMu.Lock()
+	defer pkcs11PINMu.Unlock()
+	if pkcs11PIN != nil {
+		return pkcs11PIN, nil
+	}
+
+	pin, err := readSecret(ctx.String(pkcs11PINFileFlag.Name), pkcs11PINEnv, "PKCS#11 PIN", false)
+	if err != nil {
+		return nil, err
+	}
+	pkcs11PIN = pin
+	return pkcs11PIN, nil
+}
+
+var exportPassword []byte
+
+// getExportPassword reads the password protecting exported key stores from the password file, the environment or the terminal.
+func getExportPassword(ctx *cli.Context) ([]byte, error) {
+	if exportPassword != nil {
+		return exportPassword, nil
+	}
+
+	password, err := readSecret(ctx.String(exportPasswordFileFlag.Name), exportPasswordEnv, "export password", true)
+	if err != nil {
+		return nil, err
+	}
+	exportPassword = password
+	return exportPassword, nil
+}
+
+// readSecret reads a secret from the given file, the environment variable or the terminal.
+// If confirm is set a prompted secret has to be entered twice.
+func readSecret(filename, env, description string, confirm bool) ([]byte, error) {
+	if filename != "" {
+		secret, err := os.ReadFile(filename)
+		if err != nil {
+			logrus.WithError(err).WithField("filename", filename).Errorf("Failed to read %s file", description)
+			return nil, err
+		}
+		return bytes.TrimRight(secret, "\r\n"), nil
+	}
+
+	if envSecret := os.Getenv(env); envSecret != "" {
+		return []byte(envSecret), nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Enter the %s:\n", description)
+	secret, err := term.ReadPassword(int(syscall.Stdin))
+	if err != nil {
+		logrus.WithError(err).Errorf("Failed to read %s", description)
+		return nil, err
+	}
+	if confirm {
+		fmt.Fprintf(os.Stderr, "Confirm the %s:\n", description)
+		confirmation, err := term.ReadPassword(int(syscall.Stdin))
+		if err != nil {
+			logrus.WithError(err).Errorf("Failed to read %s", description)
+			return nil, err
+		}
+		if !bytes.Equal(secret, confirmation) {
+			return nil, fmt.Errorf("%ss do not match", description)
+		}
+	}
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("%s must not be empty", description)
+	}
+	return secret, nil
+}
+
+// keyPassphraseFunc returns a cert.PassphraseFunc which is only invoked for encrypted keys.
+func keyPassphraseFunc(ctx *cli.Context) cert.PassphraseFunc {
+	return func() ([]byte, error) {
+		return getKeyPassphrase(ctx, false)
+	}
+}
+
+// pkcs11PINFunc returns a cert.PassphraseFunc which is only invoked for PKCS#11 URIs without a PIN.
+func pkcs11PINFunc(ctx *cli.Context) cert.PassphraseFunc {
+	return func() ([]byte, error) {
+		return getPKCS11PIN(ctx)
+	}
+}
+
+// withWriteFlags adds the output file flags to a command which writes files
+// and creates the output directory before the command runs.
+func withWriteFlags(cmd *cli.Command) *cli.Command {
+	cmd.Flags = append(cmd.Flags, forceFlag, backupFlag, outDirFlag)
+	if cmd.Before != nil {
+		cmd.Before = combinedCheckFuncs(cmd.Before, createOutDir)
+	} else {
+		cmd.Before = createOutDir
+	}
+	return cmd
+}
+
+// writeOptionsFromFlags returns how existing output files are treated.
+func writeOptionsFromFlags(ctx *cli.Context) cert.WriteOptions {
+	backup := ctx.Bool(backupFlag.Name)
+	return cert.WriteOptions{
+		Force:  ctx.Bool(forceFlag.Name) || backup,
+		Backup: backup,
+	}
+}
+
+func createOutDir(ctx *cli.Context) error {
+	if outDir := ctx.String(outDirFlag.Name); outDir != "" {
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			logrus.WithError(err).WithField("out_dir", outDir).Error("Failed to create output directory")
+			return err
+		}
+	}
+	return nil
+}
+
+// defaultOutfile returns the output file named after a certificate. The name may be returned by DRIVR,
+// so it must be a plain file name.
+func defaultOutfile(ctx *cli.Context, name, extension string) (string, error) {
+	if !isPlainFileName(name) {
+		return "", fmt.Errorf("certificate name %q cannot be used as file name, specify the output file", name)
+	}
+	return outputPath(ctx, fmt.Sprintf("%s.%s", name, extension)), nil
+}
+
+// isPlainFileName reports whether name is a file name without a path which is not hidden.
+func isPlainFileName(name string) bool {
+	return name != "" && name == filepath.Base(name) && !strings.HasPrefix(name, ".")
+}
+
+// outputPath places relative output files in the output directory.
+func outputPath(ctx *cli.Context, filename string) string {
+	outDir := ctx.String(outDirFlag.Name)
+	if outDir == "" || filepath.IsAbs(filename) {
+		return filename
+	}
+	return filepath.Join(outDir, filename)
+}
+
 func getAPIUrl(ctx *cli.Context) string {
 	apiURL := ctx.String(drivrAPIURLFlag.Name)
 	if !strings.HasPrefix(apiURL, "http") {
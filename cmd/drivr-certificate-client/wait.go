@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"github.com/xcnt/drivr-certificate-client/api"
+)
+
+// waitProgressInterval is the interval in which the progress of waiting for a certificate is logged.
+const waitProgressInterval = 15 * time.Second
+
+var (
+	waitTimeoutFlag = &cli.DurationFlag{
+		Name:    "wait-timeout",
+		Usage:   "Maximum time to wait for DRIVR to sign the certificate, 0 waits until interrupted",
+		Value:   2 * time.Minute,
+		EnvVars: []string{"DRIVR_WAIT_TIMEOUT"},
+	}
+	waitIntervalFlag = &cli.DurationFlag{
+		Name:  "wait-interval",
+		Usage: "Initial interval in which DRIVR is asked whether the certificate has been signed. It doubles up to --wait-max-interval",
+		Value: time.Second,
+	}
+	waitMaxIntervalFlag = &cli.DurationFlag{
+		Name:  "wait-max-interval",
+		Usage: "Maximum interval in which DRIVR is asked whether the certificate has been signed",
+		Value: 15 * time.Second,
+	}
+	noWaitFlag = &cli.BoolFlag{
+		Name:  "no-wait",
+		Usage: "Only request the certificate and print its UUID. Fetch it later with 'fetch certificate --wait'",
+	}
+	waitFlag = &cli.BoolFlag{
+		Name:  "wait",
+		Usage: "Wait until the certificate has been signed",
+	}
+)
+
+// waitOptions controls how long and how often a requested certificate is polled until it is signed.
+type waitOptions struct {
+	// Timeout limits the total wait, zero waits until the context is cancelled.
+	Timeout     time.Duration
+	Interval    time.Duration
+	MaxInterval time.Duration
+}
+
+// withWaitFlags adds the wait flags to a command which waits for certificates
+// and checks them before the command runs.
+func withWaitFlags(cmd *cli.Command) *cli.Command {
+	cmd.Flags = append(cmd.Flags, waitTimeoutFlag, waitIntervalFlag, waitMaxIntervalFlag)
+	if cmd.Before != nil {
+		cmd.Before = combinedCheckFuncs(cmd.Before, checkWaitOptions)
+	} else {
+		cmd.Before = checkWaitOptions
+	}
+	return cmd
+}
+
+func checkWaitOptions(ctx *cli.Context) error {
+	options := waitOptionsFromFlags(ctx)
+	if options.Timeout < 0 {
+		return fmt.Errorf("%s must not be negative", waitTimeoutFlag.Name)
+	}
+	if options.Interval <= 0 || options.MaxInterval < options.Interval {
+		return fmt.Errorf("%s must be positive and not exceed %s", waitIntervalFlag.Name, waitMaxIntervalFlag.Name)
+	}
+	return nil
+}
+
+// waitOptionsFromFlags returns the wait options of a command wrapped with withWaitFlags.
+func waitOptionsFromFlags(ctx *cli.Context) waitOptions {
+	return waitOptions{
+		Timeout:     ctx.Duration(waitTimeoutFlag.Name),
+		Interval:    ctx.Duration(waitIntervalFlag.Name),
+		MaxInterval: ctx.Duration(waitMaxIntervalFlag.Name),
+	}
+}
+
+// waitForCertificate polls DRIVR until the certificate has been signed and returns the DER encoded certificate
+// and its name. Waiting stops on errors other than the certificate not being signed yet or DRIVR not being
+// reachable, when the wait timeout elapses and when the context is cancelled.
+func waitForCertificate(ctx context.Context, drivrAPI *api.DrivrAPI, certificateUUID *uuid.UUID, options waitOptions) ([]byte, string, error) {
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+
+	log := logrus.WithField("certificate_uuid", certificateUUID)
+	start := time.Now()
+	nextProgress := start
+	interval := options.Interval
+	for {
+		certificate, name, err := drivrAPI.FetchCertificate(ctx, certificateUUID)
+		if err == nil {
+			log.WithField("waited", time.Since(start).Round(time.Second)).Debug("Certificate signed")
+			return certificate, name, nil
+		}
+		if ctx.Err() != nil {
+			return nil, "", waitError(ctx, certificateUUID)
+		}
+		if !errors.Is(err, api.ErrNotYetSigned) && !errors.Is(err, api.ErrTransport) {
+			return nil, "", err
+		}
+
+		if now := time.Now(); !now.Before(nextProgress) {
+			log.WithField("waited", now.Sub(start).Round(time.Second)).Info("Waiting for the certificate to be signed")
+			nextProgress = now.Add(waitProgressInterval)
+		}
+		log.WithError(err).WithField("retry_in", interval).Debug("Certificate not available yet")
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, "", waitError(ctx, certificateUUID)
+		case <-timer.C:
+		}
+		interval = min(2*interval, options.MaxInterval)
+	}
+}
+
+// waitError describes why waiting for the certificate stopped and how it can be fetched later.
+func waitError(ctx context.Context, certificateUUID *uuid.UUID) error {
+	hint := fmt.Sprintf("fetch it later with 'fetch certificate --uuid %s --wait'", certificateUUID)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out waiting for certificate, %s: %w", hint, api.ErrNotYetSigned)
+	}
+	return fmt.Errorf("interrupted while waiting for certificate, %s: %w", hint, context.Canceled)
+}